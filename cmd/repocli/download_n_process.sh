@@ -16,11 +16,16 @@ DR_COLL_DIR=/dccn/DAC_3010000.05_873
 # path of project directory
 PROJECT_DIR=/project/3010000.05
 
+# the template prints the path of the sub-directories only, one per line, also if it contains spaces
+DIRS_ONLY='{{if .IsDir}}{{.Path}}{{end}}'
+
 # loop over subject folders in the DR collection
-for subdir in $($REPOCLI_BIN ls -l ${DR_COLL_DIR}/raw_bitcoin_tutorial | grep '^ d' | awk '{print $NF}'); do
+mapfile -t subdirs < <($REPOCLI_BIN ls --format "${DIRS_ONLY}" ${DR_COLL_DIR}/raw_bitcoin_tutorial)
+for subdir in "${subdirs[@]}"; do
 
     # loop over session folders in each subject folder
-    for sesdir in $($REPOCLI_BIN ls -l "${subdir}" | grep '^ d' | awk '{print $NF}'); do
+    mapfile -t sesdirs < <($REPOCLI_BIN ls --format "${DIRS_ONLY}" "${subdir}")
+    for sesdir in "${sesdirs[@]}"; do
         
         # download session folder into the `wordir` sub-folder of the project directory
         dstdir=${PROJECT_DIR}/workdir/$(basename "${sesdir}")
@@ -31,7 +36,7 @@ for subdir in $($REPOCLI_BIN ls -l ${DR_COLL_DIR}/raw_bitcoin_tutorial | grep '^
         # process the data only if the download is completed successfully
         if [ $? -eq 0 ]; then
             echo "Processing downloaded data ${dstdir} ..."
-            dcm2niix -o ${PROJECT_DIR}/nifti/$(basename "${subdir}")/$(basename "${sesdir}") -g y "${dstdir}"
+            dcm2niix -o "${PROJECT_DIR}/nifti/$(basename "${subdir}")/$(basename "${sesdir}")" -g y "${dstdir}"
 
             echo "Removing downloaded data ${dstdir} ..."
             rm -rf "${dstdir}"
@@ -0,0 +1,190 @@
+package repocli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sync"
+
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"golang.org/x/term"
+)
+
+// credential is the credential of the webdav server, shared by the client `cli`, the requests
+// of `davRequest` and all workers.  The generation `gen` is increased whenever the credential
+// is renewed.
+var credential struct {
+	mutex    sync.Mutex
+	user     string
+	pass     string
+	gen      int
+	rejected bool
+	// basicOnly is set when the server does not accept the session cookies without the credential.
+	basicOnly bool
+}
+
+// sessionJar keeps the session cookies returned by the server.
+var sessionJar, _ = cookiejar.New(nil)
+
+// setCredential sets a new credential, and drops the session cookies of the previous one.
+func setCredential(user, pass string) {
+	credential.mutex.Lock()
+	defer credential.mutex.Unlock()
+	credential.user, credential.pass = user, pass
+	credential.gen++
+	credential.rejected = false
+	credential.basicOnly = false
+	sessionJar, _ = cookiejar.New(nil)
+}
+
+// getCredential returns the current credential and its generation.
+func getCredential() (user, pass string, gen int) {
+	credential.mutex.Lock()
+	defer credential.mutex.Unlock()
+	return credential.user, credential.pass, credential.gen
+}
+
+// renewCredential prompts the user for a new password after the credential of generation `gen` is
+// rejected by the server.  Concurrent workers hitting the same rejection are prompted only once, and
+// wait for the renewed credential.  It returns true if a new credential is available.
+//
+// The user is only prompted in the shell mode with a terminal; an empty password gives up renewing
+// the credential for the rest of the session.
+func renewCredential(gen int) bool {
+	credential.mutex.Lock()
+	defer credential.mutex.Unlock()
+
+	switch {
+	case credential.gen != gen:
+		// renewed by another worker in the meantime
+		return true
+	case credential.rejected:
+		return false
+	case !shellMode || !term.IsTerminal(int(os.Stdin.Fd())):
+		credential.rejected = true
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "\nauthentication failed, password for %s (empty to give up): ", credential.user)
+	b, _ := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+
+	if len(b) == 0 {
+		credential.rejected = true
+		return false
+	}
+
+	credential.pass = string(b)
+	credential.gen++
+	sessionJar, _ = cookiejar.New(nil)
+
+	// save the renewed credential if the configuration file has one
+	if c, err := config.LoadConfig(configFile); err == nil && c.Repository.Password != "" {
+		if err := saveConfig(davBaseURL, credential.user, credential.pass, true); err != nil {
+			log.Warnf("cannot save renewed credential: %s", err)
+		}
+	}
+	return true
+}
+
+// sessionTransport is a `http.RoundTripper` reusing the session cookies of the server across
+// requests and workers.  With a session cookie, the basic authentication is left out if the
+// request can be re-sent with the credential when the session has expired.
+//
+// The basic authentication always uses the current credential.  On a 401 response, it renews
+// the credential via `renewCredential` and re-sends the request, if possible.
+type sessionTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the `http.RoundTripper` interface.
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	_, _, basic := req.BasicAuth()
+	rewindable := req.Body == nil || req.GetBody != nil
+
+	// try the session cookies first, then the credential
+	resp, gen, cookieOnly, err := t.send(req, basic, basic && rewindable)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !basic {
+		return resp, err
+	}
+
+	if cookieOnly {
+		// the session has expired, or the server does not authenticate with the session cookies.
+		// The expired cookies are dropped; the latter is assumed for the rest of the session if the
+		// credential is accepted without a new session cookie.
+		credential.mutex.Lock()
+		sessionJar, _ = cookiejar.New(nil)
+		credential.mutex.Unlock()
+		resp.Body.Close()
+		if resp, gen, _, err = t.send(rewind(req), true, false); err != nil || resp.StatusCode != http.StatusUnauthorized {
+			if err == nil && len(resp.Cookies()) == 0 {
+				credential.mutex.Lock()
+				credential.basicOnly = true
+				credential.mutex.Unlock()
+			}
+			return resp, err
+		}
+	}
+
+	// the credential is rejected
+	if !renewCredential(gen) || !rewindable {
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp, _, _, err = t.send(rewind(req), true, false)
+	return resp, err
+}
+
+// send sends a copy of `req` with the session cookies and, if `basic` is set, the basic authentication
+// with the current credential.  The authentication is left out if `preferCookie` is set and there are
+// session cookies.  It returns the generation of the credential, and whether the request is sent with
+// the session cookies only.
+func (t *sessionTransport) send(req *http.Request, basic, preferCookie bool) (*http.Response, int, bool, error) {
+
+	credential.mutex.Lock()
+	user, pass, gen := credential.user, credential.pass, credential.gen
+	jar, basicOnly := sessionJar, credential.basicOnly
+	credential.mutex.Unlock()
+
+	r := req.Clone(req.Context())
+	cookies := jar.Cookies(r.URL)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+
+	cookieOnly := false
+	if basic {
+		if preferCookie && !basicOnly && len(cookies) > 0 {
+			r.Header.Del("Authorization")
+			cookieOnly = true
+		} else {
+			r.SetBasicAuth(user, pass)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return resp, gen, cookieOnly, err
+	}
+	if rc := resp.Cookies(); len(rc) > 0 {
+		jar.SetCookies(r.URL, rc)
+	}
+	return resp, gen, cookieOnly, nil
+}
+
+// rewind returns a copy of `req` with the body rewound, for sending the request again.
+func rewind(req *http.Request) *http.Request {
+	if req.GetBody == nil {
+		return req
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return req
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r
+}
@@ -0,0 +1,129 @@
+package repocli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionTransport(t *testing.T) {
+
+	// the server authenticates with the basic authentication or the session cookie
+	session := "s1"
+	nbasic := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil && c.Value == session {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if u, p, ok := r.BasicAuth(); ok && u == "user" && p == "secret" {
+			nbasic++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: session})
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	setCredential("user", "secret")
+	defer setCredential("", "")
+
+	client := &http.Client{Transport: &sessionTransport{next: http.DefaultTransport}}
+
+	get := func() int {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.SetBasicAuth("user", "stale")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the first request authenticates with the current credential, not the one of the request
+	for i := 0; i < 3; i++ {
+		if s := get(); s != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, s)
+		}
+	}
+	if nbasic != 1 {
+		t.Errorf("expected 1 request with basic authentication, got %d", nbasic)
+	}
+
+	// an expired session falls back to the basic authentication
+	session = "s2"
+	if s := get(); s != http.StatusOK {
+		t.Fatalf("expected status 200 after session expiry, got %d", s)
+	}
+	if nbasic != 2 {
+		t.Errorf("expected 2 requests with basic authentication, got %d", nbasic)
+	}
+
+	// the new session cookie is used again after the expiry
+	if s := get(); s != http.StatusOK || nbasic != 2 {
+		t.Errorf("expected the new session cookie, got status %d with %d basic authentications", s, nbasic)
+	}
+
+	// a rejected credential is not renewed outside the shell mode
+	setCredential("user", "rotated")
+	if s := get(); s != http.StatusUnauthorized {
+		t.Errorf("expected status 401 with rejected credential, got %d", s)
+	}
+
+	// a request with a body that cannot be rewound is sent once, with the credential
+	setCredential("user", "secret")
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, struct{ *strings.Reader }{strings.NewReader("data")})
+	req.SetBasicAuth("user", "secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || nbasic != 3 {
+		t.Errorf("expected status 200 with basic authentication, got %d (%d)", resp.StatusCode, nbasic)
+	}
+}
+
+func TestSessionTransportBasicOnly(t *testing.T) {
+
+	// the server issues a session cookie once, but does not authenticate with it
+	ncookie, nreq := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nreq++
+		if u, p, ok := r.BasicAuth(); ok && u == "user" && p == "secret" {
+			if ncookie == 0 {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+				ncookie++
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	setCredential("user", "secret")
+	defer setCredential("", "")
+
+	client := &http.Client{Transport: &sessionTransport{next: http.DefaultTransport}}
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.SetBasicAuth("user", "secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, resp.StatusCode)
+		}
+	}
+
+	// the cookie is tried once, then the basic authentication is sent right away
+	if nreq != 4 {
+		t.Errorf("expected 4 requests to the server, got %d", nreq)
+	}
+}
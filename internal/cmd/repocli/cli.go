@@ -2,11 +2,11 @@ package repocli
 
 import (
 	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -56,7 +56,6 @@ const (
 // var dataDir string
 var recursive bool
 var overwrite bool = false
-var maxretry uint8 = 2
 var longformat bool
 var errfile string
 var mgetDir string
@@ -86,16 +85,23 @@ If no argument is provided, it lists the content of the root ("/") WebDAV path.
 				p = getCleanRepoPath(args[0])
 			}
 
-			files := make([]fs.FileInfo, 0)
+			entries := make([]listEntry, 0)
 
 			// check path state
 			if f, err := cli.Stat(p); err == nil {
 				if !f.IsDir() {
 					// path is a file
-					files = append(files, f)
+					e := newListEntry(p, f)
+					// in case of listing a single file, the `f.Name`` from the `cli.State` is empty.
+					// we need to get the filename from the input argument `p`
+					e.Name, e.display = path.Base(p), path.Base(p)
+					entries = append(entries, e)
 				} else {
-					// path is a dir, read the entire content of the dir
-					if files, err = cli.ReadDir(p); err != nil {
+					// path is a dir, read the entire content of the dir, recursively if requested
+					w := treeWalker{list: listRepo, tree: listRepoTree, joinSrc: path.Join}
+					if entries, err = listEntries(context.Background(), p, w, path.Join); err != nil {
+						// the entries listed are shown before the error
+						printEntries(entries)
 						return err
 					}
 				}
@@ -105,13 +111,13 @@ If no argument is provided, it lists the content of the root ("/") WebDAV path.
 				p, pat = path.Split(p)
 				if strings.ContainsAny(pat, `*?[`) {
 					// wildcard listing, read the entire content of the parent dir
-					if entries, err := cli.ReadDir(p); err != nil {
+					if files, err := cli.ReadDir(p); err != nil {
 						return err
 					} else {
 						// filter out entries with name matches the glob
-						for _, f := range entries {
+						for _, f := range files {
 							if m, _ := path.Match(pat, f.Name()); m {
-								files = append(files, f)
+								entries = append(entries, newListEntry(path.Join(p, f.Name()), f))
 							}
 						}
 					}
@@ -120,27 +126,12 @@ If no argument is provided, it lists the content of the root ("/") WebDAV path.
 				}
 			}
 
-			// listing
-			if longformat {
-				for _, f := range files {
-					fmt.Printf("%11s %12d %s %s\n", f.Mode(), f.Size(), f.ModTime().Format(time.UnixDate), path.Join(p, f.Name()))
-				}
-			} else {
-				isDirMarker := make(map[bool]string, 2)
-				isDirMarker[true] = "/"
-				isDirMarker[false] = ""
-
-				for _, f := range files {
-					if f.Name() == "" {
-						// in case of listing a single file, the `f.Name`` from the `cli.State` is empty.
-						// we need to get the filename from the input argument `p`
-						fmt.Printf("%s%s\n", path.Base(p), isDirMarker[f.Mode().IsDir()])
-						continue
-					}
-					fmt.Printf("%s%s\n", f.Name(), isDirMarker[f.Mode().IsDir()])
-				}
+			// the privileges of the current user instead of the mode, which is not provided by WebDAV
+			if longformat || output != outputText || strings.Contains(listFormat, ".Privileges") {
+				setPrivileges(context.Background(), entries)
 			}
-			return nil
+
+			return printEntries(entries)
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			// get list of content in this directory
@@ -156,6 +147,7 @@ If no argument is provided, it lists the content of the root ("/") WebDAV path.
 	}
 
 	cmd.Flags().BoolVarP(&longformat, "long", "l", false, "list files with more detail")
+	addListingFlags(cmd)
 
 	return cmd
 }
@@ -184,11 +176,13 @@ results in the content of /tmp/data being uploaded into a new repository directo
 
 will have the content of /tmp/data uploaded into /dccn/DAC_3010000.01_173/data.
 
-By default, the upload process will skip existing files already in the repository. A file is considered "existing" if its destination has the same size and later modification time comparing to its source. One can use the "-f" flag to overwrite existing files.
+By default, the upload process will skip existing files already in the repository. A file is considered "existing" if its destination has the same size and later modification time comparing to its source. The "--compare" flag selects another strategy for detecting existing files, i.e. "size" for the same size only, "checksum" for the same MD5 checksum, "etag" for an unchanged ETag since the last transfer, or "always" for considering all files as changed.  The "--mtime-window" flag allows a tolerance on comparing the modification time, e.g. to cope with the clock skew between the local host and the repository.  One can use the "-f" flag to overwrite existing files. The "--on-conflict" flag sets the policy for existing files that are considered changed (default "overwrite"): "skip" keeps the existing file, "overwrite" replaces it, "newer" replaces it only if the source is newer, "rename" writes the source into a new file with a numbered suffix (e.g. "MANIFEST.txt.1"), "backup" keeps the existing file with a numbered suffix before replacing it, and "ask" prompts for the policy per file.
 	`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			// resolve into absolute path at local
 			lfpath, err := filepath.Abs(args[0])
 
@@ -211,6 +205,12 @@ By default, the upload process will skip existing files already in the repositor
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
+			// stop gracefully when the `--max-transfer` or `--max-duration` budget is exhausted
+			startBudget(ctx, cancel)
+
 			// a file or a directory
 			pfinfoLocal := pathFileInfo{
 				path: lfpath,
@@ -220,6 +220,16 @@ By default, the upload process will skip existing files already in the repositor
 			p := getCleanRepoPath(args[1])
 			f, rerr := cli.Stat(p)
 
+			// files are uploaded into temporary files renamed afterwards, which requires both adding
+			// and removing entries in the destination directory.
+			dstDir := path.Dir(p)
+			if rerr == nil && f.IsDir() {
+				dstDir = p
+			}
+			if err := requirePrivilege(ctx, dstDir, privBind|privUnbind, "uploading into "+dstDir); err != nil {
+				return err
+			}
+
 			if lfinfo.IsDir() {
 
 				if rerr == nil && !f.IsDir() {
@@ -240,24 +250,30 @@ By default, the upload process will skip existing files already in the repositor
 					path: p,
 				}
 
+				if err := preflightPut(ctx, []opInput{{src: pfinfoLocal, dst: pfinfoRepo}}, dstDir); err != nil {
+					return err
+				}
+
 				// create top-level directory in advance
-				cli.MkdirAll(pfinfoRepo.path, pfinfoLocal.info.Mode())
+				mkdirRepo(ctx, pfinfoRepo.path, pfinfoLocal.info.Mode(), true)
 
 				// start progress showing transfer rate in bytes
 				pbar := initDynamicMaxProgressbar("uploading...", true)
 
 				// walk through repo directories
-				ichan := make(chan opInput, 1000000)
+				ichan := make(chan opInput, opQueueSize)
 				go func() {
 					walkLocalDirForPut(ctx, pfinfoLocal, pfinfoRepo, ichan, true, pbar)
-					pbar.ChangeMax(pbar.GetMax() - 1)
+					addProgressMax(pbar, -1)
 				}()
 
-				// perform data transfer with 4 concurrent workers
-				cntOk, cntErr := runOp(ctx, Put, ichan, 4, pbar)
+				// perform data transfer with concurrent workers
+				cntOk, cntErr := runOp(ctx, Put, ichan, getNumWorkers(), pbar, nil)
 
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -274,7 +290,16 @@ By default, the upload process will skip existing files already in the repositor
 				pfinfoRepo := pathFileInfo{
 					path: p,
 				}
-				return putRepoFile(pfinfoLocal, pfinfoRepo, true)
+				if err := preflightPut(ctx, []opInput{{src: pfinfoLocal, dst: pfinfoRepo}}, dstDir); err != nil {
+					return err
+				}
+				if res := runSingleOp(ctx, Put, opInput{src: pfinfoLocal, dst: pfinfoRepo}, true); res.err != nil {
+					return res.err
+				}
+				if plan != nil {
+					plan.summary(1)
+				}
+				return nil
 			}
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -300,9 +325,15 @@ By default, the upload process will skip existing files already in the repositor
 	}
 
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
-	cmd.Flags().Uint8VarP(&maxretry, "retry", "r", maxretry, "make `N` retry attempts on failed put")
+	addCompareFlags(cmd)
+	addConflictFlags(cmd, conflictOverwrite)
+	addRetryFlags(cmd, "r")
 	cmd.Flags().StringVarP(&errfile, "error", "e", "", "save upload errors to the specified `file`")
 
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addLimitFlags(cmd)
+	addPreflightFlag(cmd)
 	return cmd
 }
 
@@ -330,11 +361,13 @@ results in the content of /dccn/DAC_3010000.01_173/data being downloaded into a
 
 will have the content of /dccn/DAC_3010000.01_173/data downloaded into /tmp/data.
 
-By default, the download process will skip existing files already in the repository.  A file is considered "existing" if its destination has the same size and later modification time comparing to its source.  One can use the "-f" flag to overwrite existing files.
+By default, the download process will skip existing files already in the repository.  A file is considered "existing" if its destination has the same size and later modification time comparing to its source.  The "--compare" flag selects another strategy for detecting existing files, i.e. "size" for the same size only, "checksum" for the same MD5 checksum, "etag" for an unchanged ETag since the last transfer, or "always" for considering all files as changed.  The "--mtime-window" flag allows a tolerance on comparing the modification time, e.g. to cope with the clock skew between the local host and the repository.  One can use the "-f" flag to overwrite existing files. The "--on-conflict" flag sets the policy for existing files that are considered changed (default "overwrite"): "skip" keeps the existing file, "overwrite" replaces it, "newer" replaces it only if the source is newer, "rename" writes the source into a new file with a numbered suffix (e.g. "MANIFEST.txt.1"), "backup" keeps the existing file with a numbered suffix before replacing it, and "ask" prompts for the policy per file.
 	`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			p := getCleanRepoPath(args[0])
 
 			f, err := cli.Stat(p)
@@ -363,6 +396,12 @@ By default, the download process will skip existing files already in the reposit
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
+			// stop gracefully when the `--max-transfer` or `--max-duration` budget is exhausted
+			startBudget(ctx, cancel)
+
 			lfinfo, lerr := os.Stat(lp)
 
 			// download recursively
@@ -386,7 +425,11 @@ By default, the download process will skip existing files already in the reposit
 
 				log.Debugf("download content of %s into %s", pfinfoRepo.path, pfinfoLocal.path)
 
-				if err := os.MkdirAll(lp, pfinfoRepo.info.Mode()); err != nil {
+				if err := preflightGet(ctx, []opInput{{src: pfinfoRepo, dst: pfinfoLocal}}, lp); err != nil {
+					return err
+				}
+
+				if err := mkdirLocal(lp, pfinfoRepo.info.Mode()); err != nil {
 					return err
 				}
 
@@ -394,17 +437,19 @@ By default, the download process will skip existing files already in the reposit
 				pbar := initDynamicMaxProgressbar("downloading...", true)
 
 				// walk through repo directories
-				ichan := make(chan opInput, 1000000)
+				ichan := make(chan opInput, opQueueSize)
 				go func() {
 					walkRepoDirForGet(ctx, pfinfoRepo, pfinfoLocal, ichan, true, pbar)
-					pbar.ChangeMax(pbar.GetMax() - 1)
+					addProgressMax(pbar, -1)
 				}()
 
-				// perform data transfer with 4 concurrent workers
-				cntOk, cntErr := runOp(ctx, Get, ichan, 4, pbar)
+				// perform data transfer with concurrent workers
+				cntOk, cntErr := runOp(ctx, Get, ichan, getNumWorkers(), pbar, nil)
 
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -420,8 +465,18 @@ By default, the download process will skip existing files already in the reposit
 					path: lp,
 				}
 
+				if err := preflightGet(ctx, []opInput{{src: pfinfoRepo, dst: pfinfoLocal}}, filepath.Dir(lp)); err != nil {
+					return err
+				}
+
 				// download single file
-				return getRepoFile(pfinfoRepo, pfinfoLocal, !silent)
+				if res := runSingleOp(ctx, Get, opInput{src: pfinfoRepo, dst: pfinfoLocal}, !silent); res.err != nil {
+					return res.err
+				}
+				if plan != nil {
+					plan.summary(1)
+				}
+				return nil
 			}
 
 		},
@@ -448,9 +503,15 @@ By default, the download process will skip existing files already in the reposit
 	}
 
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
-	cmd.Flags().Uint8VarP(&maxretry, "retry", "r", maxretry, "make `N` retry attempts on failed get")
+	addCompareFlags(cmd)
+	addConflictFlags(cmd, conflictOverwrite)
+	addRetryFlags(cmd, "r")
 	cmd.Flags().StringVarP(&errfile, "error", "e", "", "save download errors to the specified `file`")
 
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addLimitFlags(cmd)
+	addPreflightFlag(cmd)
 	return cmd
 }
 
@@ -488,6 +549,8 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			// resolve destination to local absolute path
 			lp, err := filepath.Abs(mgetDir)
 			if err != nil {
@@ -513,11 +576,32 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
+			// stop gracefully when the `--max-transfer` or `--max-duration` budget is exhausted
+			startBudget(ctx, cancel)
+
+			// resolve common parent into a clean, absolute path
+			mgetStrip := getCleanRepoPath(mgetStrip)
+
+			// check the free space for all sources before starting the transfer
+			inputs := make([]opInput, 0, len(args))
+			for _, arg := range args {
+				p := getCleanRepoPath(arg)
+				if f, err := cli.Stat(p); err == nil {
+					inputs = append(inputs, opInput{src: pathFileInfo{path: p, info: f}, dst: pathFileInfo{path: mgetDest(lp, p, mgetStrip)}})
+				}
+			}
+			if err := preflightGet(ctx, inputs, lp); err != nil {
+				return err
+			}
+
 			// progress bar showing transfer rate in bytes
 			pbar := initDynamicMaxProgressbar("downloading...", true)
 
 			// channel for queueing operations
-			ichan := make(chan opInput, 1000000)
+			ichan := make(chan opInput, opQueueSize)
 
 			// channel for notifying main process that all operations are done
 			wchan := make(chan struct{})
@@ -526,19 +610,18 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 			// running operations
 			go func() {
 
-				// perform data transfer with 4 concurrent workers
-				cntOk, cntErr := runOp(ctx, Get, ichan, 4, pbar)
+				// perform data transfer with concurrent workers
+				cntOk, cntErr := runOp(ctx, Get, ichan, getNumWorkers(), pbar, nil)
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
 				wchan <- struct{}{}
 			}()
 
-			// resolve common parent into a clean, absolute path
-			mgetStrip := getCleanRepoPath(mgetStrip)
-
 			// walk through all arguments to construct operation inputs
 		loop:
 			for _, arg := range args {
@@ -563,16 +646,8 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 
 					if f.IsDir() {
 
-						// construction local destination taking into account `mgetStrip`
-						var elp = []string{lp}
-						if parents {
-							elp = append(elp, strings.Split(strings.TrimPrefix(p, mgetStrip), "/")...)
-						} else {
-							elp = append(elp, path.Base(p))
-						}
-
-						lpp := filepath.Join(elp...)
-						if err := os.MkdirAll(lpp, 0755); err != nil {
+						lpp := mgetDest(lp, p, mgetStrip)
+						if err := mkdirLocal(lpp, 0755); err != nil {
 							log.Errorf("%s\n", err)
 						}
 
@@ -583,18 +658,10 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 
 					} else {
 
-						pbar.ChangeMax64(pbar.GetMax64() + pfinfoRepo.info.Size())
-
-						elp := []string{lp}
-
-						if parents {
-							elp = append(elp, strings.Split(strings.TrimPrefix(p, mgetStrip), "/")...)
-						} else {
-							elp = append(elp, path.Base(p))
-						}
+						addProgressMax(pbar, pfinfoRepo.info.Size())
 
-						lpp := filepath.Join(elp...)
-						if err := os.MkdirAll(filepath.Dir(lpp), 0755); err != nil {
+						lpp := mgetDest(lp, p, mgetStrip)
+						if err := mkdirLocal(filepath.Dir(lpp), 0755); err != nil {
 							log.Errorf("%s\n", err)
 						}
 
@@ -613,7 +680,7 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 			close(ichan)
 
 			// substract the pbar artifact due to dynamic total
-			pbar.ChangeMax(pbar.GetMax() - 1)
+			addProgressMax(pbar, -1)
 
 			// waiting for all operations are done
 			<-wchan
@@ -666,9 +733,15 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 	cmd.Flags().BoolVarP(&parents, "parents", "", false, "use full source name under destination")
 	cmd.Flags().StringVarP(&mgetStrip, "strip", "", cwd, "leading `path` to be stripped away from source paths when using the --parents flag")
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
+	addCompareFlags(cmd)
+	addConflictFlags(cmd, conflictOverwrite)
 	cmd.Flags().StringVarP(&errfile, "error", "e", "", "save download errors to the specified `file`")
-	cmd.Flags().Uint8VarP(&maxretry, "retry", "r", maxretry, "make `N` retry attempts on failed get")
+	addRetryFlags(cmd, "r")
 
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addLimitFlags(cmd)
+	addPreflightFlag(cmd)
 	return cmd
 }
 
@@ -706,6 +779,8 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			// make sure destination is a directory
 			rp := getCleanRepoPath(mputDir)
 			rfinfo, err := cli.Stat(rp)
@@ -732,11 +807,32 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
+			// stop gracefully when the `--max-transfer` or `--max-duration` budget is exhausted
+			startBudget(ctx, cancel)
+
+			// check the quota for all sources before starting the transfer
+			inputs := make([]opInput, 0, len(args))
+			for _, arg := range args {
+				lp, err := filepath.Abs(arg)
+				if err != nil {
+					continue
+				}
+				if lf, err := os.Stat(lp); err == nil {
+					inputs = append(inputs, opInput{src: pathFileInfo{path: lp, info: lf}, dst: pathFileInfo{path: mputDest(rp, lp, mputStrip)}})
+				}
+			}
+			if err := preflightPut(ctx, inputs, rp); err != nil {
+				return err
+			}
+
 			// progress bar showing transfer rate in bytes
 			pbar := initDynamicMaxProgressbar("uploading...", true)
 
 			// channel for queueing operations
-			ichan := make(chan opInput, 1000000)
+			ichan := make(chan opInput, opQueueSize)
 
 			// channel for notifying main process that all operations are done
 			wchan := make(chan struct{})
@@ -745,10 +841,12 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 			// running operations
 			go func() {
 
-				// perform data transfer with 4 concurrent workers
-				cntOk, cntErr := runOp(ctx, Put, ichan, 4, pbar)
+				// perform data transfer with concurrent workers
+				cntOk, cntErr := runOp(ctx, Put, ichan, getNumWorkers(), pbar, nil)
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -782,16 +880,8 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 
 					if lf.IsDir() {
 
-						// construction local destination taking into account `mputStrip`
-						var erp = []string{rp}
-						if parents {
-							erp = append(erp, strings.Split(strings.TrimPrefix(lp, mputStrip), string(os.PathSeparator))...)
-						} else {
-							erp = append(erp, filepath.Base(lp))
-						}
-
-						rpp := path.Join(erp...)
-						if err := cli.MkdirAll(rpp, 0755); err != nil {
+						rpp := mputDest(rp, lp, mputStrip)
+						if err := mkdirRepo(ctx, rpp, 0755, true); err != nil {
 							log.Errorf("%s\n", err)
 						}
 
@@ -802,18 +892,10 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 
 					} else {
 
-						pbar.ChangeMax64(pbar.GetMax64() + pfinfoLocal.info.Size())
-
-						erp := []string{rp}
-
-						if parents {
-							erp = append(erp, strings.Split(strings.TrimPrefix(lp, mputStrip), string(os.PathSeparator))...)
-						} else {
-							erp = append(erp, path.Base(lp))
-						}
+						addProgressMax(pbar, pfinfoLocal.info.Size())
 
-						rpp := path.Join(erp...)
-						if err := cli.MkdirAll(path.Dir(rpp), 0755); err != nil {
+						rpp := mputDest(rp, lp, mputStrip)
+						if err := mkdirRepo(ctx, path.Dir(rpp), 0755, true); err != nil {
 							log.Errorf("%s\n", err)
 						}
 
@@ -832,7 +914,7 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 			close(ichan)
 
 			// substract the pbar artifact due to dynamic total
-			pbar.ChangeMax(pbar.GetMax() - 1)
+			addProgressMax(pbar, -1)
 
 			// waiting for all operations are done
 			<-wchan
@@ -855,9 +937,15 @@ The "--parents" flag can be combined with the "--strip" flag to strip a part on
 	cmd.Flags().BoolVarP(&parents, "parents", "", false, "use full source name under destination")
 	cmd.Flags().StringVarP(&mputStrip, "strip", "", lcwd, "leading `path` to be stripped away from source paths when using the --parents flag")
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
+	addCompareFlags(cmd)
+	addConflictFlags(cmd, conflictOverwrite)
 	cmd.Flags().StringVarP(&errfile, "error", "e", "", "save download errors to the specified `file`")
-	cmd.Flags().Uint8VarP(&maxretry, "retry", "r", maxretry, "make `N` retry attempts on failed put")
+	addRetryFlags(cmd, "r")
 
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addLimitFlags(cmd)
+	addPreflightFlag(cmd)
 	return cmd
 }
 
@@ -884,11 +972,20 @@ results in the content of /dccn/DAC_3010000.01_173/data being copied into a new
 
 will have the content of /dccn/DAC_3010000.01_173/data copied into /dccn/DAC_3010000.01_173/data.new.
 
-By default, the copy process will skip existing files at the destination.  One can use the "-f" flag to overwrite existing files.
+By default, the copy process will skip existing files at the destination.  One can use the "-f" flag to overwrite existing files. The "--on-conflict" flag sets the policy for existing files (default "skip"): "skip" keeps the existing file, "overwrite" replaces it, "newer" replaces it only if the source is newer, "rename" writes the source into a new file with a numbered suffix (e.g. "MANIFEST.txt.1"), "backup" keeps the existing file with a numbered suffix before replacing it, and "ask" prompts for the policy per file.
+
+The files are copied by the server.  If the server cannot copy a file, e.g. across collections on different storage back-ends (responses 405, 501, 502 or 507), the file is streamed through the client instead, i.e. downloaded and uploaded again, and verified with its size and MD5 checksum.  The flag "--server-side-only" disables this fallback.
 	`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			// the ETag of the source tells nothing about another file at the destination.
+			if compare == compareETag {
+				return fmt.Errorf("--compare %s not supported, the ETags of two repository files are not comparable", compare)
+			}
+
+			initPlan()
+
 			src := getCleanRepoPath(args[0])
 			dst := getCleanRepoPath(args[1])
 
@@ -906,6 +1003,9 @@ By default, the copy process will skip existing files at the destination.  One c
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
 			fdst, derr := cli.Stat(dst)
 
 			if fsrc.IsDir() {
@@ -933,20 +1033,22 @@ By default, the copy process will skip existing files at the destination.  One c
 
 				log.Debugf("copying %s to %s", pfinfoSrc.path, pfinfoDst.path)
 
-				if err := cli.MkdirAll(dst, pfinfoSrc.info.Mode()); err != nil {
+				if err := mkdirRepo(ctx, dst, pfinfoSrc.info.Mode(), true); err != nil {
 					return err
 				}
 
 				// start progress with copying rate in number of copied files
 				pbar := initDynamicMaxProgressbar("copying...", false)
 
-				// run with 4 concurrent workers
+				// run with concurrent workers
 				cntOk, cntErr, err := copyOrMoveRepoDir(ctx, Copy, pfinfoSrc, pfinfoDst, pbar)
 
-				pbar.ChangeMax(pbar.GetMax() - 1)
+				addProgressMax(pbar, -1)
 
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -960,7 +1062,17 @@ By default, the copy process will skip existing files at the destination.  One c
 					dst = path.Join(dst, path.Base(src))
 				}
 				log.Debugf("copying %s to %s", src, dst)
-				return cli.Copy(src, dst, overwrite)
+				res := runSingleOp(ctx, Copy, opInput{src: pathFileInfo{path: src, info: fsrc}, dst: pathFileInfo{path: dst}}, false)
+				if res.err != nil {
+					return res.err
+				}
+				if res.skipped && plan == nil && !silent && events == nil {
+					log.Infof("skipped %s: %s", src, skipReason(Copy, dst))
+				}
+				if plan != nil {
+					plan.summary(1)
+				}
+				return nil
 			}
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -976,6 +1088,12 @@ By default, the copy process will skip existing files at the destination.  One c
 		},
 	}
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
+	addCompareFlags(cmd)
+	addConflictFlags(cmd, conflictSkip)
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addRetryFlags(cmd, "")
+	addServerSideFlag(cmd)
 	return cmd
 }
 
@@ -1003,13 +1121,19 @@ results in the content of /dccn/DAC_3010000.01_173/data being moved into a new r
 
 will have the content of /dccn/DAC_3010000.01_173/data moved into /dccn/DAC_3010000.01_173/data.new.
 
-By default, the move process will skip existing files at the destination.  One can use the "-f" flag to overwrite existing files.
+By default, the move process will skip existing files at the destination.  One can use the "-f" flag to overwrite existing files. The "--on-conflict" flag sets the policy for existing files (default "skip"): "skip" keeps the existing file, "overwrite" replaces it, "newer" replaces it only if the source is newer, "rename" writes the source into a new file with a numbered suffix (e.g. "MANIFEST.txt.1"), "backup" keeps the existing file with a numbered suffix before replacing it, and "ask" prompts for the policy per file.
 
 Files not successfully moved over will be kept at the source.
+
+The files are moved by the server.  If the server cannot move a file, e.g. across collections on different storage back-ends (responses 405, 501, 502 or 507), the file is streamed through the client instead, i.e. downloaded and uploaded again, and verified with its size and MD5 checksum.  The flag "--server-side-only" disables this fallback.
+
+Moving away a collection or a directory directly within a collection is to be confirmed interactively, unless the flag "--yes" is given.  Paths matching the "protected" patterns in the "safety" section of the configuration file are never moved away.
 	`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			src := getCleanRepoPath(args[0])
 			dst := getCleanRepoPath(args[1])
 
@@ -1027,8 +1151,26 @@ Files not successfully moved over will be kept at the source.
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
 			fdst, derr := cli.Stat(dst)
 
+			// moving requires removing the source from its directory, and adding into the destination directory.
+			dstDir := path.Dir(dst)
+			if derr == nil && fdst.IsDir() {
+				dstDir = dst
+			}
+			if err := requirePrivilege(ctx, path.Dir(src), privUnbind, "moving "+src); err != nil {
+				return err
+			}
+			if err := requirePrivilege(ctx, dstDir, privBind, "moving into "+dstDir); err != nil {
+				return err
+			}
+			if err := guardRemoval(ctx, "moving", src, fsrc, false); err != nil {
+				return err
+			}
+
 			if fsrc.IsDir() {
 
 				// destination path exists but not a directory.
@@ -1054,20 +1196,43 @@ Files not successfully moved over will be kept at the source.
 
 				log.Debugf("renaming %s to %s", pfinfoSrc.path, pfinfoDst.path)
 
-				if err := cli.MkdirAll(dst, pfinfoSrc.info.Mode()); err != nil {
+				// moving into an existing directory merges the content, which cannot be undone.
+				_, err := cli.Stat(dst)
+				merged := err == nil
+
+				if err := mkdirRepo(ctx, dst, pfinfoSrc.info.Mode(), true); err != nil {
 					return err
 				}
 
 				// start progress in moving rate in number of moved files
 				pbar := initDynamicMaxProgressbar("moving...", true)
 
-				// perform data transfer with 4 concurrent workers
+				// perform data transfer with concurrent workers
 				cntOk, cntErr, err := copyOrMoveRepoDir(ctx, Move, pfinfoSrc, pfinfoDst, pbar)
 
-				pbar.ChangeMax(pbar.GetMax() - 1)
+				addProgressMax(pbar, -1)
+
+				// the move is only journaled as undoable if the source is walked and moved completely,
+				// i.e. nothing is left behind, e.g. files skipped by the conflict policy.
+				left := false
+				if plan == nil && cntErr == 0 && err == nil {
+					_, serr := cli.Stat(src)
+					left = !dav.IsErrNotFound(serr)
+				}
+
+				switch {
+				case merged:
+					recordOperation(journalEntry{Op: "mv", Irreversible: "moved into the existing directory " + dst})
+				case cntErr > 0 || err != nil || left:
+					recordOperation(journalEntry{Op: "mv", Irreversible: "not all files are moved into " + dst})
+				default:
+					recordOperation(journalEntry{Op: "mv", Moves: []journalMove{{From: src, To: dst}}})
+				}
 
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -1077,11 +1242,36 @@ Files not successfully moved over will be kept at the source.
 
 				return nil
 			} else {
+				// an existing destination replaced by the move cannot be restored by undo.
+				existed := derr == nil && !fdst.IsDir()
 				if derr == nil && fdst.IsDir() {
 					dst = path.Join(dst, path.Base(src))
+					_, serr := cli.Stat(dst)
+					existed = serr == nil
 				}
 				log.Debugf("renaming %s to %s", src, dst)
-				return cli.Rename(src, dst, overwrite)
+				res := runSingleOp(ctx, Move, opInput{src: pathFileInfo{path: src, info: fsrc}, dst: pathFileInfo{path: dst}}, false)
+				if res.err != nil {
+					return res.err
+				}
+				// the file may be written to another path by the conflict policy, or not moved at all.
+				switch {
+				case res.skipped:
+					if plan == nil && !silent && events == nil {
+						log.Infof("skipped %s: %s", src, skipReason(Move, dst))
+					}
+				case res.backup != "":
+					// undo moves the file back, and then the backup in place of it.
+					recordOperation(journalEntry{Op: "mv", Moves: []journalMove{{From: dst, To: res.backup}, {From: src, To: dst}}})
+				case existed && res.written == dst:
+					recordOperation(journalEntry{Op: "mv", Irreversible: "the existing file " + dst + " is overwritten"})
+				default:
+					recordOperation(journalEntry{Op: "mv", Moves: []journalMove{{From: src, To: res.written}}})
+				}
+				if plan != nil {
+					plan.summary(1)
+				}
+				return nil
 			}
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -1097,6 +1287,12 @@ Files not successfully moved over will be kept at the source.
 		},
 	}
 	cmd.Flags().BoolVarP(&overwrite, "overwrite", "f", overwrite, "overwrite the existing file")
+	addConflictFlags(cmd, conflictSkip)
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
+	addRetryFlags(cmd, "")
+	addServerSideFlag(cmd)
+	addConfirmFlag(cmd)
 	return cmd
 }
 
@@ -1111,10 +1307,16 @@ The "rm" subcommand is for removing a file or a directory in the repository.
 The mandatory argument is used to specify the file or directory in the repository to be removed.  The argument can be in form of an absolute or relative WebDAV path with the path separator "/", for example, "/dccn/DAC_3010000.01_173/data".
 
 When removing a directory containing files or sub-directories, the flag "-r" should be applied to do the removal recursively.
+
+With the flag "--trash", the file or directory is moved into the trash of the collection instead of being removed permanently.  It can be restored with the "trash restore" or the "undo" subcommand.
+
+Removing a collection, a directory directly within a collection, or more files than the "confirm_threshold" in the "safety" section of the configuration file (default 100), is to be confirmed interactively; the flag "--yes" skips the confirmation, e.g. in scripts.  Paths matching the "protected" patterns in the "safety" section are never removed.
 		`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			initPlan()
+
 			rp := getCleanRepoPath(args[0])
 
 			f, err := cli.Stat(rp)
@@ -1122,6 +1324,10 @@ When removing a directory containing files or sub-directories, the flag "-r" sho
 				return err
 			}
 
+			if err := requirePrivilege(cmd.Context(), path.Dir(rp), privUnbind, "removing "+rp); err != nil {
+				return err
+			}
+
 			ctx, cancel := context.WithCancel(cmd.Context())
 			defer cancel()
 			go func() {
@@ -1130,18 +1336,58 @@ When removing a directory containing files or sub-directories, the flag "-r" sho
 				cancel()
 			}()
 
+			// adaptive concurrency limiter for `--nthreads auto`
+			startLimiter(ctx)
+
+			if err := guardRemoval(ctx, "removing", rp, f, recursive); err != nil {
+				return err
+			}
+
+			if useTrash {
+				if f.IsDir() && !recursive {
+					files, err := cli.ReadDir(rp)
+					if err != nil {
+						return err
+					}
+					if len(files) > 0 {
+						return fmt.Errorf("directory not empty: %s", rp)
+					}
+				}
+				t, root, err := moveToTrash(ctx, rp, f)
+				if err != nil {
+					return explainLocked(ctx, err, rp)
+				}
+				if plan != nil {
+					plan.summary(1)
+					return nil
+				}
+				recordOperation(journalEntry{Op: "rm", Moves: []journalMove{{From: rp, To: t.item(root)}}, Trash: root, Item: t.ID})
+				log.Infof("moved %s into the trash: %s", rp, t.ID)
+				return nil
+			}
+
+			// files removed permanently, even partially, cannot be restored by "undo"; the last operation
+			// is kept undoable if nothing is removed.
+			removed := journalEntry{Op: "rm", Irreversible: rp + " is removed permanently"}
+
 			if f.IsDir() {
 
 				// start progress with removing rate in number of files
 				pbar := initDynamicMaxProgressbar("removing...", false)
 
-				// perform data transfer with 4 concurrent workers
+				// perform data transfer with concurrent workers
 				cntOk, cntErr, err := rmRepoDir(ctx, rp, recursive, pbar)
 
-				pbar.ChangeMax(pbar.GetMax() - 1)
+				addProgressMax(pbar, -1)
+
+				if cntOk > 0 || err == nil {
+					recordOperation(removed)
+				}
 
 				// log statistics
-				if !silent {
+				if plan != nil {
+					plan.summary(nthreads.n)
+				} else if !silent && events == nil {
 					log.Infof("no. succeeded: %d, no. failed: %d", cntOk, cntErr)
 				}
 
@@ -1151,7 +1397,14 @@ When removing a directory containing files or sub-directories, the flag "-r" sho
 
 				return nil
 			} else {
-				return cli.Remove(rp)
+				if err := removeRepo(ctx, pathFileInfo{path: rp, info: f}); err != nil {
+					return explainLocked(ctx, err, rp)
+				}
+				recordOperation(removed)
+				if plan != nil {
+					plan.summary(1)
+				}
+				return nil
 			}
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -1167,6 +1420,11 @@ When removing a directory containing files or sub-directories, the flag "-r" sho
 		},
 	}
 	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "remove directory recursively")
+	addTrashFlag(cmd)
+	addConfirmFlag(cmd)
+	addRetryFlags(cmd, "")
+	addDryRunFlag(cmd)
+	addReportFlag(cmd)
 	return cmd
 }
 
@@ -1182,7 +1440,10 @@ During the creation, any missing parents directories are also created automatica
 `,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return cli.MkdirAll(getCleanRepoPath(args[0]), 0664)
+		p := getCleanRepoPath(args[0])
+		return withRetry(cmd.Context(), "mkdir "+p, func() error {
+			return cli.MkdirAll(p, 0664)
+		})
 	},
 	ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		// get list of content in this directory
@@ -1197,6 +1458,30 @@ During the creation, any missing parents directories are also created automatica
 	},
 }
 
+// mgetDest returns the local path in the destination directory `lp` to which the repository source
+// `p` is downloaded, with the leading `strip` removed from `p` if the `--parents` flag is set.
+func mgetDest(lp, p, strip string) string {
+	elp := []string{lp}
+	if parents {
+		elp = append(elp, strings.Split(strings.TrimPrefix(p, strip), "/")...)
+	} else {
+		elp = append(elp, path.Base(p))
+	}
+	return filepath.Join(elp...)
+}
+
+// mputDest returns the repository path in the destination directory `rp` to which the local source
+// `lp` is uploaded, with the leading `strip` removed from `lp` if the `--parents` flag is set.
+func mputDest(rp, lp, strip string) string {
+	erp := []string{rp}
+	if parents {
+		erp = append(erp, strings.Split(strings.TrimPrefix(lp, strip), string(os.PathSeparator))...)
+	} else {
+		erp = append(erp, filepath.Base(lp))
+	}
+	return path.Join(erp...)
+}
+
 // getCleanRepoPath resolves provided path into a clean absolute path taking into account
 // the `cwd`.
 func getCleanRepoPath(p string) string {
@@ -1208,7 +1493,10 @@ func getCleanRepoPath(p string) string {
 
 // runOp performs file operation `Op` with input data provided through the
 // channel `ichan`.
-func runOp(ctx context.Context, op Op, ichan chan opInput, nworkers int, pbar *pb.ProgressBar) (cntOk, cntErr int) {
+//
+// The optional function `done` is called with the result of every operation, including
+// whether the source is skipped and left untouched.
+func runOp(ctx context.Context, op Op, ichan chan opInput, nworkers int, pbar *pb.ProgressBar, done func(in opInput, skipped bool, err error)) (cntOk, cntErr int) {
 
 	// error log writer
 	errWriter := os.Stderr
@@ -1221,11 +1509,19 @@ func runOp(ctx context.Context, op Op, ichan chan opInput, nworkers int, pbar *p
 		errWriter = f
 	}
 
+	// report of every file, written as the files are processed
+	report := openReport(op)
+	defer closeReport(ctx, report)
+
+	events.jobStart(op, nworkers)
+	defer func() { events.jobSummary(ctx, op, cntOk, cntErr) }()
+
 	// initalize concurrent workers
 	var wg sync.WaitGroup
+	var mutex sync.Mutex
 	for i := 0; i < nworkers; i++ {
 		wg.Add(1)
-		go func() {
+		go func(n int) {
 			defer wg.Done()
 		loop:
 			for {
@@ -1239,35 +1535,44 @@ func runOp(ctx context.Context, op Op, ichan chan opInput, nworkers int, pbar *p
 						break loop
 					}
 
-					var err error
+					if !acquireWorker(ctx) {
+						break loop
+					}
+
+					events.fileStart(op, inputs)
+
+					var tp *transferProgress
+					if op == Put || op == Get {
+						tp = newWorkerProgress(display, n, pbar)
+					}
+					res := doOp(ctx, op, inputs, tp, report != nil)
 					pinc := int64(1) // progress increment
-					switch op {
-					case Put:
-						err = putRepoFile(inputs.src, inputs.dst, false)
-						pinc = inputs.src.info.Size()
-					case Get:
-						err = getRepoFile(inputs.src, inputs.dst, false)
-						pinc = inputs.src.info.Size()
-					case Move:
-						err = cli.Rename(inputs.src.path, inputs.dst.path, overwrite)
-					case Remove:
-						err = cli.Remove(inputs.src.path)
-					case Copy:
-						cli.Copy(inputs.src.path, inputs.dst.path, overwrite)
-					default:
-						// do nothing
-						err = fmt.Errorf("unknown operation: %d", op)
+					if tp != nil {
+						pinc = tp.finish(inputs.src.info.Size())
 					}
-					if err != nil {
-						fmt.Fprintf(errWriter, "%s error:%s\n", inputs.src.path, err.Error())
+
+					mutex.Lock()
+					if res.err != nil {
+						fmt.Fprintf(errWriter, "%s error:%s\n", inputs.src.path, res.err.Error())
 						cntErr += 1
 					} else {
 						cntOk += 1
 					}
+					mutex.Unlock()
+					events.fileDone(op, res)
+					if report != nil {
+						if err := report.add(res); err != nil {
+							log.Errorf("cannot write report %s: %s", reportFile, err)
+						}
+					}
+					if done != nil {
+						done(inputs, res.skipped, res.err)
+					}
 					pbar.Add64(pinc)
+					releaseWorker(pinc)
 				}
 			}
-		}()
+		}(i)
 	}
 
 	// wait for workers to be released
@@ -1276,104 +1581,158 @@ func runOp(ctx context.Context, op Op, ichan chan opInput, nworkers int, pbar *p
 	return
 }
 
-// walkLocalDirForPut walks through a local directory and creates inputs for putting files from local to repo.
-func walkLocalDirForPut(ctx context.Context, pfinfoLocal, pfinfoRepo pathFileInfo, ichan chan opInput, closeChanOnComplete bool, pbar *pb.ProgressBar) {
-	// read the entire content of the dir
-	files, err := ioutil.ReadDir(pfinfoLocal.path)
-	if err != nil {
-		return
+// doOp performs the operation `op` on a single file with the input `in`.  The bytes of a `Put` or
+// `Get` are reported to `tp`, with the checksum of the data transferred if `hash` is set.
+func doOp(ctx context.Context, op Op, in opInput, tp *transferProgress, hash bool) opResult {
+
+	res := opResult{in: in}
+	t0 := time.Now()
+	switch op {
+	case Put, Get:
+		if events != nil {
+			tp.src = in.src.path
+		}
+		if hash {
+			tp.hash = md5.New()
+		}
+		if op == Put {
+			res.err = putRepoFile(ctx, in.src, in.dst, tp)
+		} else {
+			res.err = getRepoFile(ctx, in.src, in.dst, tp)
+		}
+		res.bytes, res.attempts, res.checksum = tp.reported, tp.attempts, tp.checksum()
+		// the file is left out, e.g. unchanged, if no transfer is attempted
+		res.skipped = res.err == nil && tp.attempts == 0 && plan == nil
+	case Move, Copy:
+		res.written, res.backup, res.skipped, res.err = cliCopyOrRename(ctx, op, in.src, in.dst.path)
+	case Remove:
+		res.err = removeRepo(ctx, in.src)
+	default:
+		// do nothing
+		res.err = fmt.Errorf("unknown operation: %d", op)
 	}
+	res.duration = time.Since(t0)
+	switch op {
+	case Put:
+		res.err = explainLocked(ctx, res.err, in.dst.path)
+	case Move, Copy, Remove:
+		res.err = explainLocked(ctx, res.err, in.src.path, in.dst.path)
+	}
+	return res
+}
 
-	pbar.ChangeMax64(pbar.GetMax64() + countSize(files))
+// runSingleOp performs the operation `op` on the single file with the input `in`, e.g. a `put` of a
+// file, with the progress events and the report of `runOp`.  The transfer of a `Put` or `Get` is
+// shown on the stderr if `show` is set.
+func runSingleOp(ctx context.Context, op Op, in opInput, show bool) opResult {
 
-loop:
-	for _, finfo := range files {
-		select {
-		case <-ctx.Done():
-			log.Debugf("stopping walkRepoDirForPut ...\n")
-			break loop
-		default:
-			p := path.Join(pfinfoLocal.path, finfo.Name())
+	report := openReport(op)
+	defer closeReport(ctx, report)
 
-			// local dir pathInfo
-			_pfinfoLocal := pathFileInfo{
-				path: p,
-				info: finfo,
-			}
-			// repo dir pathInfo
-			_pfinfoRepo := pathFileInfo{
-				path: path.Join(pfinfoRepo.path, finfo.Name()),
-			}
+	cntOk, cntErr := 0, 0
+	events.jobStart(op, 1)
+	defer func() { events.jobSummary(ctx, op, cntOk, cntErr) }()
 
-			if finfo.IsDir() {
-				// create sub directory in advance
-				if err := cli.Mkdir(_pfinfoRepo.path, _pfinfoLocal.info.Mode()); err != nil {
-					log.Errorf("cannot create repo dir %s: %s", _pfinfoRepo.path, err)
-					continue
-				}
-				// walk into sub directory without closing the channel
-				walkLocalDirForPut(ctx, _pfinfoLocal, _pfinfoRepo, ichan, false, pbar)
-			} else {
-				ichan <- opInput{
-					src: _pfinfoLocal,
-					dst: _pfinfoRepo,
-				}
-			}
+	events.fileStart(op, in)
+	var tp *transferProgress
+	if op == Put || op == Get {
+		tp = newFileProgress(show)
+	}
+	res := doOp(ctx, op, in, tp, report != nil)
+	if res.err != nil {
+		cntErr++
+	} else {
+		cntOk++
+	}
+	events.fileDone(op, res)
+	if report != nil {
+		if err := report.add(res); err != nil {
+			log.Errorf("cannot write report %s: %s", reportFile, err)
 		}
 	}
+	return res
+}
 
-	if closeChanOnComplete {
-		close(ichan)
+// openReport creates the report of the operation `op` if the `--report` flag is set, except in the
+// dry-run mode.  A failure is only logged, as the operation proceeds without the report.
+func openReport(op Op) *transferReport {
+	if reportFile == "" || plan != nil {
+		return nil
 	}
+	report, err := newTransferReport(reportFile, op)
+	if err != nil {
+		log.Errorf("cannot create report %s: %s", reportFile, err)
+		return nil
+	}
+	return report
 }
 
-// walkRepoDirForGet walks through a repo directory and creates inputs for getting files from repo to local.
-func walkRepoDirForGet(ctx context.Context, pfinfoRepo, pfinfoLocal pathFileInfo, ichan chan opInput, closeChanOnComplete bool, pbar *pb.ProgressBar) {
-
-	// read the entire content of the dir
-	files, err := cli.ReadDir(pfinfoRepo.path)
-	if err != nil {
+// closeReport writes the summary of the operation, possibly cancelled via `ctx`, to the `report`
+// if it is not `nil`.
+func closeReport(ctx context.Context, report *transferReport) {
+	if report == nil {
 		return
 	}
+	if err := report.close(ctx); err != nil {
+		log.Errorf("cannot write report %s: %s", reportFile, err)
+	}
+}
 
-	// push number of total files in this directory for updating progress bar
-	pbar.ChangeMax64(pbar.GetMax64() + countSize(files))
-
-	// loop over content
-loop:
-	for _, finfo := range files {
-		select {
-		case <-ctx.Done():
-			log.Debugf("stopping walkRepoDirForGet ...\n")
-			break loop
-		default:
-			p := path.Join(pfinfoRepo.path, finfo.Name())
-
-			// repo dir pathInfo
-			_pfinfoRepo := pathFileInfo{
-				path: p,
-				info: finfo,
-			}
-			// local dir pathInfo
-			_pfinfoLocal := pathFileInfo{
-				path: filepath.Join(pfinfoLocal.path, finfo.Name()),
+// walkLocalDirForPut walks through a local directory and creates inputs for putting files from local to repo.
+func walkLocalDirForPut(ctx context.Context, pfinfoLocal, pfinfoRepo pathFileInfo, ichan chan opInput, closeChanOnComplete bool, pbar *pb.ProgressBar) {
+	w := treeWalker{
+		list:    listLocal,
+		joinSrc: filepath.Join,
+		joinDst: path.Join,
+		onList: func(dir opInput, files []fs.FileInfo) {
+			addProgressMax(pbar, countSize(files))
+			events.scanned(dir.src.path, files)
+		},
+		onDir: func(dir opInput) bool {
+			// create sub directory in advance
+			if err := mkdirRepo(ctx, dir.dst.path, dir.src.info.Mode(), false); err != nil {
+				log.Errorf("cannot create repo dir %s: %s", dir.dst.path, err)
+				return false
 			}
+			return true
+		},
+	}
+	if err := w.walk(ctx, opInput{src: pfinfoLocal, dst: pfinfoRepo}, ichan); err != nil {
+		log.Errorf("%s", err)
+	}
 
-			if finfo.IsDir() {
-				// create sub directory in advance
-				if err := os.MkdirAll(_pfinfoLocal.path, _pfinfoRepo.info.Mode()); err != nil {
-					log.Errorf("cannot create local dir %s: %s", _pfinfoLocal.path, err)
-					continue
-				}
-				// walk into sub directory without closing the channel
-				walkRepoDirForGet(ctx, _pfinfoRepo, _pfinfoLocal, ichan, false, pbar)
-			} else {
-				ichan <- opInput{
-					src: _pfinfoRepo,
-					dst: _pfinfoLocal,
-				}
+	if closeChanOnComplete {
+		close(ichan)
+	}
+}
+
+// walkRepoDirForGet walks through a repo directory and creates inputs for getting files from repo to local.
+func walkRepoDirForGet(ctx context.Context, pfinfoRepo, pfinfoLocal pathFileInfo, ichan chan opInput, closeChanOnComplete bool, pbar *pb.ProgressBar) {
+	w := treeWalker{
+		list:    listRepo,
+		tree:    listRepoTree,
+		skip:    isPartialRepoFile,
+		joinSrc: path.Join,
+		joinDst: filepath.Join,
+		onList: func(dir opInput, files []fs.FileInfo) {
+			addProgressMax(pbar, countSize(files))
+			events.scanned(dir.src.path, files)
+			// remove temporary files left by previous, interrupted downloads
+			if plan == nil {
+				cleanPartialLocal(dir.dst.path, files)
 			}
-		}
+		},
+		onDir: func(dir opInput) bool {
+			// create sub directory in advance
+			if err := mkdirLocal(dir.dst.path, dir.src.info.Mode()); err != nil {
+				log.Errorf("cannot create local dir %s: %s", dir.dst.path, err)
+				return false
+			}
+			return true
+		},
+	}
+	if err := w.walk(ctx, opInput{src: pfinfoRepo, dst: pfinfoLocal}, ichan); err != nil {
+		log.Errorf("%s", err)
 	}
 
 	if closeChanOnComplete {
@@ -1381,22 +1740,24 @@ loop:
 	}
 }
 
-// putRepoFile uploads a single local file to the repository.
-func putRepoFile(pfinfoLocal, pfinfoRepo pathFileInfo, showProgress bool) error {
-
-	// determine local file size and modification time
-	ltsize := pfinfoLocal.info.Size()
-	ltmtime := pfinfoLocal.info.ModTime()
+// putRepoFile uploads a single local file to the repository, reporting the bytes uploaded to `tp`.
+func putRepoFile(ctx context.Context, pfinfoLocal, pfinfoRepo pathFileInfo, tp *transferProgress) error {
 
 	if pfinfoLocal.info.Mode()&fs.ModeSymlink != 0 {
 		// print a warning if the file is a symbolic link
 		logger.Warnf("symlink %s will be uploaded as regular file", pfinfoLocal.path)
 		if tinfo, err := os.Stat(pfinfoLocal.path); err == nil {
-			ltsize = tinfo.Size()
-			ltmtime = tinfo.ModTime()
+			pfinfoLocal.info = tinfo
 		}
 	}
 
+	// determine local file size
+	ltsize := pfinfoLocal.info.Size()
+
+	// the state of the destination observed here, which should be unchanged when the uploaded
+	// file is moved into place.  Overwriting with `--overwrite` is unconditional.
+	var pre precondition
+
 	if !overwrite {
 		// don't want existing files to be overwritten
 		if stat, err := cli.Stat(pfinfoRepo.path); !dav.IsErrNotFound(err) {
@@ -1404,29 +1765,46 @@ func putRepoFile(pfinfoLocal, pfinfoRepo pathFileInfo, showProgress bool) error
 			// fail to stat remote path, but the failure is no `file not found`.
 			if err != nil {
 				log.Debugf("skip file fail to check signature: %s\n", pfinfoRepo.path)
+				if plan != nil {
+					plan.add(planSkip, pfinfoLocal.path, pfinfoRepo.path, ltsize)
+				}
 				return nil
 			}
 
-			// compare file size
-			hasSameSize := stat.Size() == ltsize
-
-			// compare file modtime
-			isRepoNewer := stat.ModTime().After(ltmtime)
-
-			if hasSameSize && isRepoNewer {
-				log.Debugf("skip file with same signature (size + modtime): %s\n", pfinfoRepo.path)
+			pfinfoRepo.info = stat
+			if same, err := unchanged(Put, pfinfoLocal, pfinfoRepo); err != nil {
+				return err
+			} else if same {
+				log.Debugf("skip file with same signature (%s): %s\n", compare, pfinfoRepo.path)
+				if plan != nil {
+					plan.add(planSkip, pfinfoLocal.path, pfinfoRepo.path, ltsize)
+				}
 				return nil
 			}
+
+			p, _, replace, proceed, err := resolveConflict(Put, pfinfoLocal, pfinfoRepo)
+			if err != nil || !proceed {
+				return err
+			}
+			pfinfoRepo.path = p
+			if replace {
+				pre.etag = getETag(stat)
+			} else {
+				pre.absent = true
+			}
+		} else {
+			pre.absent = true
 		}
 	}
 
+	if plan != nil {
+		plan.add(planPut, pfinfoLocal.path, pfinfoRepo.path, ltsize)
+		return nil
+	}
+
 	doPut := func() error {
 		// progress bar
-		barDesc := prettifyProgressbarDesc(pfinfoLocal.info.Name())
-		bar := pb.DefaultBytesSilent(pfinfoLocal.info.Size(), barDesc)
-		if showProgress {
-			bar = pb.DefaultBytes(pfinfoLocal.info.Size(), barDesc)
-		}
+		tp.start(prettifyProgressbarDesc(pfinfoLocal.info.Name()), pfinfoLocal.info.Size())
 
 		// open pathLocal
 		reader, err := os.Open(pfinfoLocal.path)
@@ -1435,49 +1813,46 @@ func putRepoFile(pfinfoLocal, pfinfoRepo pathFileInfo, showProgress bool) error
 		}
 		defer reader.Close()
 
-		// read pathRepo and write to pathLocal, the mode is not actually useful (!?)
-		err = cli.WriteStream(pfinfoRepo.path, reader, pfinfoLocal.info.Mode())
+		// upload to a hidden temporary file, and move it to the final name once the upload is completed,
+		// so that a partial upload is never visible under the final name.
+		ptemp := getPartialPathRepo(pfinfoRepo.path)
+
+		// read pathLocal and write to pathRepo, the mode is not actually useful (!?)
+		err = cli.WriteStream(ptemp, progressReader{throttledReader{reader, ctx}, tp}, pfinfoLocal.info.Mode())
 		if err != nil {
-			return fmt.Errorf("cannot write %s to the repository: %s", pfinfoRepo.path, err)
+			cli.Remove(ptemp)
+			return fmt.Errorf("cannot write %s to the repository: %w", pfinfoRepo.path, err)
 		}
 
 		// file size check after upload
-		f, err := cli.Stat(pfinfoRepo.path)
+		f, err := cli.Stat(ptemp)
 		if err != nil {
-			return fmt.Errorf("cannot stat %s at the repository: %s", pfinfoRepo.path, err)
+			cli.Remove(ptemp)
+			return fmt.Errorf("cannot stat %s at the repository: %w", ptemp, err)
 		}
 
 		if f.Size() != ltsize {
-			return fmt.Errorf("file size %s mis-match: %d != %d", pfinfoRepo.path, f.Size(), ltsize)
+			cli.Remove(ptemp)
+			return retryableError{fmt.Errorf("file size %s mis-match: %d != %d", pfinfoRepo.path, f.Size(), ltsize)}
 		}
 
-		// TODO: this jumps from 0% to 100% ... not ideal but there is no way with to get upload progression with the webdav client library
-		bar.Add64(f.Size())
+		fctx, cancel := finalizeContext(ctx)
+		defer cancel()
+		if err := moveRepoIf(fctx, ptemp, pfinfoRepo.path, pre); err != nil {
+			cli.Remove(ptemp)
+			return fmt.Errorf("cannot move %s to %s: %w", ptemp, pfinfoRepo.path, err)
+		}
 
-		return nil
-	}
+		recordTransfer(pfinfoLocal.path, pfinfoRepo.path)
 
-	c := 0
-loop:
-	for {
-		if err := doPut(); err != nil {
-			c += 1
-			if c <= int(maxretry) {
-				log.Debugf("%s, retrying #%d", err, c)
-				continue
-			} else {
-				return err
-			}
-		} else {
-			break loop
-		}
+		return nil
 	}
 
-	return nil
+	return withRetry(ctx, "put "+pfinfoLocal.path, doPut)
 }
 
-// getRepoFile downloads a single file from the repository to a local file.
-func getRepoFile(pfinfoRepo, pfinfoLocal pathFileInfo, showProgress bool) error {
+// getRepoFile downloads a single file from the repository to a local file, reporting the bytes downloaded to `tp`.
+func getRepoFile(ctx context.Context, pfinfoRepo, pfinfoLocal pathFileInfo, tp *transferProgress) error {
 
 	if !overwrite {
 
@@ -1487,44 +1862,59 @@ func getRepoFile(pfinfoRepo, pfinfoLocal pathFileInfo, showProgress bool) error
 			// fail to stat local path, but the failure is not `file not found`.
 			if err != nil {
 				log.Debugf("skip file fail to check signature: %s\n", pfinfoLocal.path)
+				if plan != nil {
+					plan.add(planSkip, pfinfoRepo.path, pfinfoLocal.path, pfinfoRepo.info.Size())
+				}
 				return nil
 			}
 
-			// compare file size
-			hasSameSize := stat.Size() == pfinfoRepo.info.Size()
-
-			// compare file modtime
-			isLocalNewer := stat.ModTime().After(pfinfoRepo.info.ModTime())
-
-			if hasSameSize && isLocalNewer {
-				log.Debugf("skip file with same signature (size + modtime): %s\n", pfinfoLocal.path)
+			pfinfoLocal.info = stat
+			if same, err := unchanged(Get, pfinfoRepo, pfinfoLocal); err != nil {
+				return err
+			} else if same {
+				log.Debugf("skip file with same signature (%s): %s\n", compare, pfinfoLocal.path)
+				if plan != nil {
+					plan.add(planSkip, pfinfoRepo.path, pfinfoLocal.path, pfinfoRepo.info.Size())
+				}
 				return nil
 			}
+
+			p, _, _, proceed, err := resolveConflict(Get, pfinfoRepo, pfinfoLocal)
+			if err != nil || !proceed {
+				return err
+			}
+			pfinfoLocal.path = p
 		}
 	}
 
+	if plan != nil {
+		plan.add(planGet, pfinfoRepo.path, pfinfoLocal.path, pfinfoRepo.info.Size())
+		return nil
+	}
+
 	doGet := func() error {
 		// progress bar
-		barDesc := prettifyProgressbarDesc(path.Base(pfinfoRepo.path))
-		bar := pb.DefaultBytesSilent(pfinfoRepo.info.Size(), barDesc)
-		if showProgress {
-			bar = pb.DefaultBytes(pfinfoRepo.info.Size(), barDesc)
-		}
+		tp.start(prettifyProgressbarDesc(path.Base(pfinfoRepo.path)), pfinfoRepo.info.Size())
+
+		// download to a temporary file, and rename it to the final name once the download is completed,
+		// so that a partial download is never left under the final name.
+		ptemp := getPartialPathLocal(pfinfoLocal.path)
 
 		// open pathLocal
-		fileLocal, err := os.OpenFile(pfinfoLocal.path, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, pfinfoRepo.info.Mode())
+		fileLocal, err := os.OpenFile(ptemp, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, pfinfoRepo.info.Mode())
 		if err != nil {
 			return fmt.Errorf("cannot create/write local file: %s", err)
 		}
 		defer fileLocal.Close()
 
 		// multiwriter: destination local file, and progress bar
-		writer := io.MultiWriter(fileLocal, bar)
+		writer := io.MultiWriter(fileLocal, tp)
 
 		// read pathRepo and write to pathLocal
 		reader, err := cli.ReadStream(pfinfoRepo.path)
 		if err != nil {
-			return fmt.Errorf("cannot open file in repository: %s", err)
+			os.Remove(ptemp)
+			return fmt.Errorf("cannot open file in repository: %w", err)
 		}
 		defer reader.Close()
 
@@ -1534,10 +1924,13 @@ func getRepoFile(pfinfoRepo, pfinfoLocal pathFileInfo, showProgress bool) error
 			// read content to buffer
 			rlen, rerr := reader.Read(buffer)
 			if rerr != nil && rerr != io.EOF {
-				return fmt.Errorf("failure reading data from %s: %s", pfinfoRepo.path, rerr)
+				os.Remove(ptemp)
+				return fmt.Errorf("failure reading data from %s: %w", pfinfoRepo.path, rerr)
 			}
+			throttle(ctx, rlen)
 			wlen, werr := writer.Write(buffer[:rlen])
 			if werr != nil || rlen != wlen {
+				os.Remove(ptemp)
 				return fmt.Errorf("failure writing data to %s: %s", pfinfoLocal.path, werr)
 			}
 
@@ -1546,141 +1939,192 @@ func getRepoFile(pfinfoRepo, pfinfoLocal pathFileInfo, showProgress bool) error
 			}
 		}
 
+		// close the temporary file before renaming it to the final name
+		if err := fileLocal.Close(); err != nil {
+			os.Remove(ptemp)
+			return fmt.Errorf("failure writing data to %s: %s", pfinfoLocal.path, err)
+		}
+
+		if err := os.Rename(ptemp, pfinfoLocal.path); err != nil {
+			os.Remove(ptemp)
+			return fmt.Errorf("cannot rename %s to %s: %s", ptemp, pfinfoLocal.path, err)
+		}
+
+		recordTransfer(pfinfoLocal.path, pfinfoRepo.path)
+
 		return nil
 	}
 
-	c := 0
-loop:
-	for {
-		if err := doGet(); err != nil {
-			c += 1
-			if c <= int(maxretry) {
-				log.Debugf("%s, retrying #%d", err, c)
-				continue
-			} else {
-				return err
+	return withRetry(ctx, "get "+pfinfoRepo.path, doGet)
+}
+
+// simple webdav client wrapper to switch between Copy and Rename.
+//
+// Unless the `overwrite` flag is set, the conflict policy of the operation is applied when the
+// destination `dst` already exists.  It returns the path `written` at the destination, which differs
+// from `dst` if the file is renamed by the conflict policy, or `skipped` as true if the source is
+// left untouched.  The existing destination renamed by the backup policy is returned as `backup`.
+func cliCopyOrRename(ctx context.Context, op Op, src pathFileInfo, dst string) (written, backup string, skipped bool, err error) {
+
+	// the Overwrite header of the COPY/MOVE request
+	ow := overwrite
+
+	if !overwrite {
+		stat, err := cli.Stat(dst)
+		switch {
+		case err == nil:
+			pfinfoDst := pathFileInfo{
+				path: dst,
+				info: stat,
 			}
-		} else {
-			break loop
+
+			// the source is only left out when copying an identical file, as it is not
+			// removed after the move.
+			if op == Copy {
+				if same, err := unchanged(op, src, pfinfoDst); err != nil {
+					return "", "", false, err
+				} else if same {
+					log.Debugf("skip file with same signature (%s): %s\n", compare, dst)
+					if plan != nil {
+						plan.add(planSkip, src.path, dst, src.info.Size())
+					}
+					return "", "", true, nil
+				}
+			}
+
+			p, b, _, proceed, err := resolveConflict(op, src, pfinfoDst)
+			if err != nil || !proceed {
+				return "", "", !proceed, err
+			}
+			dst, backup, ow = p, b, true
+		case !dav.IsErrNotFound(err):
+			return "", "", false, err
 		}
 	}
 
-	return nil
-}
+	if plan != nil {
+		action := planCopy
+		if op == Move {
+			action = planMove
+		}
+		plan.add(action, src.path, dst, src.info.Size())
+		return dst, backup, false, nil
+	}
 
-// simple webdav client wrapper to switch between Copy and Rename.
-func cliCopyOrRename(op Op, src, dst string) error {
+	action := "copy"
 	if op == Move {
-		if err := cli.Rename(src, dst, overwrite); err != nil {
-			log.Errorf("cannot rename repo file %s: %s", src, err)
-			return err
+		action = "move"
+	}
+	attempt := 0
+	err = withRetry(ctx, action+" "+src.path, func() error {
+		var err error
+		attempt++
+		if op == Move {
+			err = cli.Rename(src.path, dst, ow)
+			// the source is gone and the destination in place, if a failed attempt is moved anyway.
+			if attempt > 1 && dav.IsErrNotFound(err) {
+				if _, serr := cli.Stat(dst); serr == nil {
+					log.Debugf("%s is moved to %s by a previous attempt", src.path, dst)
+					return nil
+				}
+			}
+		} else {
+			err = cli.Copy(src.path, dst, ow)
 		}
-	} else {
-		if err := cli.Copy(src, dst, overwrite); err != nil {
-			log.Errorf("cannot copy repo file %s: %s", src, err)
+		if serverSideOnly {
 			return err
 		}
+		return asServerSideError(err)
+	})
+
+	// the server cannot copy or move the file itself, stream it through the client instead.
+	var sse serverSideError
+	if errors.As(err, &sse) {
+		log.Warnf("server cannot %s %s (%s), streaming it through the client", action, src.path, sse)
+		return dst, backup, false, streamCopyOrMove(ctx, op, src, dst, ow)
 	}
-	return nil
+	return dst, backup, false, err
 }
 
-// copyOrMoveRepoDir moves directory from `src` to `dst` recursively.
+// copyOrMoveRepoDir copies or moves directory from `src` to `dst` recursively.
+//
+// On `Move`, the source directories are removed after their content is moved, except those
+// with files left behind due to errors or the conflict policy.
 func copyOrMoveRepoDir(ctx context.Context, op Op, src, dst pathFileInfo, pbar *pb.ProgressBar) (cntOk, cntErr int, err error) {
 
-	// read the entire content of the source directory
-	files, err := cli.ReadDir(src.path)
-	if err != nil {
-		return
-	}
-
-	pbar.ChangeMax64(pbar.GetMax64() + countFiles(files))
-
 	// make attempt to create all parent directories of the destination.
-	cli.MkdirAll(dst.path, src.info.Mode())
-
-	// channel for getting files concurrently.
-	fchan := make(chan pathFileInfo)
-
-	// initalize concurrent workers
-	var wg sync.WaitGroup
-	nworkers := 4
-	// counter for file deletion error by worker
-	cntErrFiles := make([]int, nworkers)
-	cntOkFiles := make([]int, nworkers)
-	for i := 0; i < nworkers; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-		loop:
-			for finfo := range fchan {
-				select {
-				case <-ctx.Done():
-					log.Debugf("stopping %v ...\n", op)
-					break loop
-				default:
-					if err := cliCopyOrRename(op, finfo.path, path.Join(dst.path, finfo.info.Name())); err != nil {
-						cntErrFiles[id]++
-					} else {
-						cntOkFiles[id]++
-					}
-					pbar.Add(1)
-				}
+	mkdirRepo(ctx, dst.path, src.info.Mode(), true)
+
+	// source directories to be removed after the move, and those to be kept
+	var mutex sync.Mutex
+	dirs := []string{src.path}
+	keep := make(map[string]bool)
+
+	// keepDir marks the directory `p` and its parents up to `src` to be kept.
+	keepDir := func(p string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for ; !keep[p]; p = path.Dir(p) {
+			keep[p] = true
+			if p == src.path || p == "/" {
+				break
 			}
-		}(i)
+		}
 	}
 
-	// loop over content
-loop:
-	for _, finfo := range files {
-		select {
-		case <-ctx.Done():
-			log.Debugf("stopping dir walk for %v ...\n", op)
-			break loop
-		default:
-			psrc := path.Join(src.path, finfo.Name())
-			pdst := path.Join(dst.path, path.Base(finfo.Name()))
-			if finfo.IsDir() {
-				// repo dir pathInfo
-				_pfinfoSrc := pathFileInfo{
-					path: psrc,
-					info: finfo,
-				}
-
-				_pfinfoDst := pathFileInfo{
-					path: pdst,
-				}
-
-				_cntOk, _cntErr, _ := copyOrMoveRepoDir(ctx, op, _pfinfoSrc, _pfinfoDst, pbar)
-				cntErr += _cntErr
-				cntOk += _cntOk
-			} else {
-				fchan <- pathFileInfo{
-					path: psrc,
-					info: finfo,
-				}
+	w := treeWalker{
+		list:    listRepo,
+		tree:    listRepoTree,
+		joinSrc: path.Join,
+		joinDst: path.Join,
+		onList: func(dir opInput, files []fs.FileInfo) {
+			addProgressMax(pbar, countFiles(files))
+			events.scanned(dir.src.path, files)
+		},
+		onDir: func(dir opInput) bool {
+			if err := mkdirRepo(ctx, dir.dst.path, dir.src.info.Mode(), false); err != nil {
+				log.Errorf("cannot create repo dir %s: %s", dir.dst.path, err)
+				keepDir(dir.src.path)
+				return false
 			}
-		}
+			if op == Move {
+				mutex.Lock()
+				dirs = append(dirs, dir.src.path)
+				mutex.Unlock()
+			}
+			return true
+		},
+		onFail: func(dir opInput, err error) {
+			// the content of the directory is not moved completely
+			keepDir(dir.src.path)
+		},
 	}
 
-	// close fchan to release workers
-	close(fchan)
+	// error of walking the source, read after `ichan` is closed
+	var werr error
 
-	// wait for workers to be released
-	wg.Wait()
-
-	// update overall deletion errors with error counts from workers
-	for i := 0; i < nworkers; i++ {
-		cntErr += cntErrFiles[i]
-		cntOk += cntOkFiles[i]
+	ichan := make(chan opInput, opQueueSize)
+	go func() {
+		werr = w.walk(ctx, opInput{src: src, dst: dst}, ichan)
+		close(ichan)
+	}()
 
-	}
+	cntOk, cntErr = runOp(ctx, op, ichan, getNumWorkers(), pbar, func(in opInput, skipped bool, err error) {
+		if op == Move && (skipped || err != nil) {
+			keepDir(path.Dir(in.src.path))
+		}
+	})
 
-	// remove the moved directory only if there is no error
-	if op == Move && cntErr == 0 {
-		err = cli.Remove(src.path)
+	// remove the moved directories, unless the move is interrupted.  The source is never removed
+	// if it is not walked completely.
+	if op == Move && ctx.Err() == nil {
+		if werr != nil {
+			keepDir(src.path)
+		}
+		err = removeRepoDirs(ctx, dirs, keep)
 	}
 
-	return
+	return cntOk, cntErr, errors.Join(werr, err)
 }
 
 // rmRepoDir removes the directory `path` from the repository recursively.
@@ -1692,109 +2136,85 @@ func rmRepoDir(ctx context.Context, repoPath string, recursive bool, pbar *pb.Pr
 		return
 	}
 
-	// read the entire content of the dir
-	files, err := cli.ReadDir(repoPath)
-	if err != nil {
-		return
-	}
-
 	// directory is not empty, not in recursive mode
-	if len(files) > 0 && !recursive {
-		err = fmt.Errorf("directory not empty: %s", repoPath)
-		return
+	if !recursive {
+		files, err := cli.ReadDir(repoPath)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(files) > 0 {
+			return 0, 0, fmt.Errorf("directory not empty: %s", repoPath)
+		}
 	}
 
-	pbar.ChangeMax64(pbar.GetMax64() + countFiles(files))
-
-	// channel for deleting files concurrently.
-	fchan := make(chan string)
-
-	// initalize concurrent workers
-	var wg sync.WaitGroup
-	nworkers := 4
-	// counter for file deletion error by worker
-	cntOkFiles := make([]int, nworkers)
-	cntErrFiles := make([]int, nworkers)
-	for i := 0; i < nworkers; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-		loop:
-			for f := range fchan {
-				select {
-				case <-ctx.Done():
-					log.Debugf("stopping remove ...\n")
-					break loop
-				default:
-					err := cli.Remove(f)
-					if err != nil {
-						log.Errorf("cannot remove repo file %s: %s", f, err)
-						cntErrFiles[id]++
-					} else {
-						cntOkFiles[id]++
-					}
-					pbar.Add(1)
-				}
-			}
-		}(i)
+	// directories to be removed after their content
+	var mutex sync.Mutex
+	dirs := []string{repoPath}
+
+	w := treeWalker{
+		list:    listRepo,
+		tree:    listRepoTree,
+		joinSrc: path.Join,
+		joinDst: path.Join,
+		onList: func(dir opInput, files []fs.FileInfo) {
+			addProgressMax(pbar, countFiles(files))
+			events.scanned(dir.src.path, files)
+		},
+		onDir: func(dir opInput) bool {
+			mutex.Lock()
+			dirs = append(dirs, dir.src.path)
+			mutex.Unlock()
+			return true
+		},
 	}
 
-	// loop over content
-loop:
-	for _, f := range files {
-		select {
-		case <-ctx.Done():
-			log.Debugf("stopping dir walk for remove ...\n")
-			break loop
-		default:
-			p := path.Join(repoPath, f.Name())
-			if f.IsDir() {
-				_cntOK, _cntErr, _ := rmRepoDir(ctx, p, recursive, pbar)
-				cntOk += _cntOK
-				cntErr += _cntErr
-			} else {
-				fchan <- p
-			}
+	ichan := make(chan opInput, opQueueSize)
+	go func() {
+		// the directories not listed are removed recursively with their content anyway.
+		if err := w.walk(ctx, opInput{src: pathFileInfo{path: repoPath}}, ichan); err != nil {
+			log.Errorf("%s", err)
 		}
-	}
-
-	// close fchan to release workers
-	close(fchan)
+		close(ichan)
+	}()
 
-	// wait for workers to be released
-	wg.Wait()
+	cntOk, cntErr = runOp(ctx, Remove, ichan, getNumWorkers(), pbar, nil)
 
-	// update overall deletion errors with error counts from workers
-	for i := 0; i < nworkers; i++ {
-		cntOk += cntOkFiles[i]
-		cntErr += cntErrFiles[i]
+	// remove the directories themselves, unless the removal is interrupted
+	if ctx.Err() == nil {
+		err = removeRepoDirs(ctx, dirs, nil)
 	}
-
-	// remove the directory itself
-	err = cli.Remove(repoPath)
 	return
 }
 
 // initDynamicMaxProgressbar initiates a new progress bar with a given description.
 //
 // This function assumes the caller is responsible for updating the bar's max steps
-// dynamically, and therefore the initial max is set to `1`. Caller should also reduce
-// the final max by `1` due to this artificial initial max, for example:
+// dynamically with `addProgressMax`, and therefore the initial max is set to `1`. Caller should
+// also reduce the final max by `1` due to this artificial initial max, for example:
 //
 //	bar := initDynamicMaxProgressbar()
-//	bar.ChangeMax(bar.GetMax() - 1)
+//	addProgressMax(bar, -1)
 func initDynamicMaxProgressbar(desc string, showBytes bool) *pb.ProgressBar {
-	if silent {
+	display = nil
+	if silent || plan != nil || events != nil {
 		if showBytes {
 			return pb.DefaultBytesSilent(1, desc)
 		}
 		return pb.DefaultSilent(1, desc)
 	}
 
+	// the bytes transferred by every worker are shown below the aggregate bar on a terminal
+	var w io.Writer = os.Stderr
+	if showBytes {
+		if display = newMultiProgress(); display != nil {
+			w = lineWriter{m: display}
+		}
+	}
+
 	bar := pb.NewOptions64(
 		1,
 		pb.OptionSetDescription(fmt.Sprintf("%-20s", desc)),
-		pb.OptionSetWriter(os.Stderr),
+		pb.OptionSetWriter(w),
 		pb.OptionShowBytes(showBytes),
 		pb.OptionSetWidth(10),
 		pb.OptionThrottle(65*time.Millisecond),
@@ -0,0 +1,212 @@
+package repocli
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// compareMode is the strategy for deciding whether an existing destination file
+// is identical to its source, in which case the transfer of the file is skipped.
+type compareMode string
+
+const (
+	// compareSize considers files identical if they have the same size.
+	compareSize compareMode = "size"
+	// compareSizeMtime considers files identical if they have the same size and the
+	// destination is not older than the source, with a tolerance of `mtimeWindow`.
+	compareSizeMtime compareMode = "size+mtime"
+	// compareChecksum considers files identical if they have the same MD5 checksum.
+	compareChecksum compareMode = "checksum"
+	// compareETag considers files identical if the ETag of the repository file equals
+	// to the one recorded at the last transfer, and the local file is not changed since.
+	compareETag compareMode = "etag"
+	// compareAlways considers files always different.
+	compareAlways compareMode = "always"
+)
+
+// compareModes is a list of supported compare modes.
+var compareModes = []compareMode{compareSize, compareSizeMtime, compareChecksum, compareETag, compareAlways}
+
+// String implements the `pflag.Value` interface.
+func (m *compareMode) String() string {
+	return string(*m)
+}
+
+// Set implements the `pflag.Value` interface.
+func (m *compareMode) Set(v string) error {
+	for _, mode := range compareModes {
+		if string(mode) == v {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", joinModes(compareModes))
+}
+
+// Type implements the `pflag.Value` interface.
+func (m *compareMode) Type() string {
+	return "mode"
+}
+
+var compare = compareSizeMtime
+var mtimeWindow time.Duration
+
+// addCompareFlags adds flags for selecting the change-detection strategy to the command `cmd`.
+func addCompareFlags(cmd *cobra.Command) {
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	compare = compareSizeMtime
+	cmd.Flags().Var(&compare, "compare", fmt.Sprintf("`mode` for detecting unchanged files to skip: %s", joinModes(compareModes)))
+	cmd.Flags().DurationVarP(&mtimeWindow, "mtime-window", "", 0, "tolerance `duration` of the modification time comparison, e.g. to cope with clock skew")
+}
+
+// unchanged checks whether the destination `dst` is identical to the source `src` of operation `op`,
+// using the strategy given by `compare`. Both `src.info` and `dst.info` are expected to be set.
+//
+// For the operations `Put` and `Get`, one of the two files is at local and the other is in the
+// repository; for the operations `Copy` and `Move`, both files are in the repository.
+func unchanged(op Op, src, dst pathFileInfo) (bool, error) {
+
+	if src.info.IsDir() != dst.info.IsDir() {
+		return false, nil
+	}
+
+	switch compare {
+	case compareAlways:
+		return false, nil
+
+	case compareSize:
+		return src.info.Size() == dst.info.Size(), nil
+
+	case compareSizeMtime:
+		if src.info.Size() != dst.info.Size() {
+			return false, nil
+		}
+		return !dst.info.ModTime().Add(mtimeWindow).Before(src.info.ModTime()), nil
+
+	case compareChecksum:
+		if src.info.Size() != dst.info.Size() {
+			return false, nil
+		}
+		csrc, err := checksum(src.path, op != Put)
+		if err != nil {
+			return false, err
+		}
+		cdst, err := checksum(dst.path, op != Get)
+		if err != nil {
+			return false, err
+		}
+		log.Debugf("checksum %s: %s, %s: %s", src.path, csrc, dst.path, cdst)
+		return csrc == cdst, nil
+
+	case compareETag:
+		switch op {
+		case Put:
+			return etagUnchanged(src, dst)
+		case Get:
+			return etagUnchanged(dst, src)
+		default:
+			// the ETags of two repository files are unrelated, even if the files are identical.
+			return false, fmt.Errorf("compare mode %s not supported for files in the repository", compare)
+		}
+
+	default:
+		return false, fmt.Errorf("unknown compare mode: %s", compare)
+	}
+}
+
+// checksum returns the MD5 checksum of the file content in hex string.
+// It reads the file from the repository if `remote` is true, otherwise from the local filesystem.
+func checksum(p string, remote bool) (string, error) {
+	var reader io.ReadCloser
+	var err error
+	if remote {
+		reader, err = cli.ReadStream(p)
+	} else {
+		reader, err = os.Open(p)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", fmt.Errorf("cannot compute checksum of %s: %s", p, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getETag returns the ETag of a repository file `info`, or an empty string if it is not available.
+func getETag(info fs.FileInfo) string {
+	if f, ok := info.(interface{ ETag() string }); ok {
+		return f.ETag()
+	}
+	return ""
+}
+
+// etagUnchanged compares the repository file `remote` with the transfer record of the local file `local`.
+func etagUnchanged(local, remote pathFileInfo) (bool, error) {
+	etag := getETag(remote.info)
+	if etag == "" {
+		return false, nil
+	}
+
+	r, err := getTransferRecord(local.path)
+	if err != nil {
+		log.Debugf("no transfer record for %s: %s", local.path, err)
+		return false, nil
+	}
+
+	return r.Remote == remote.path &&
+		r.ETag == etag &&
+		r.Size == local.info.Size() &&
+		r.ModTime.Equal(local.info.ModTime()), nil
+}
+
+// recordTransfer keeps the ETag of the repository file `remotePath` in the transfer record of
+// the local file `localPath`, for the `etag` compare mode to detect changes in the next run.
+// It is a no-op if another compare mode is used.
+func recordTransfer(localPath, remotePath string) {
+	if compare != compareETag {
+		return
+	}
+
+	linfo, err := os.Stat(localPath)
+	if err != nil {
+		return
+	}
+
+	rinfo, err := cli.Stat(remotePath)
+	if err != nil {
+		return
+	}
+
+	r := transferRecord{
+		Remote:  remotePath,
+		ETag:    getETag(rinfo),
+		Size:    linfo.Size(),
+		ModTime: linfo.ModTime(),
+	}
+
+	if err := setTransferRecord(localPath, r); err != nil {
+		log.Warnf("cannot save transfer record of %s: %s", localPath, err)
+	}
+}
+
+// joinModes returns a string of `modes` separated by "|".
+func joinModes[T ~string](modes []T) string {
+	s := make([]string, len(modes))
+	for i, m := range modes {
+		s[i] = string(m)
+	}
+	return strings.Join(s, "|")
+}
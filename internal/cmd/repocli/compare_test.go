@@ -0,0 +1,75 @@
+package repocli
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+// testFileInfo is a minimal `fs.FileInfo` implementation for testing.
+type testFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	etag    string
+}
+
+func (f testFileInfo) Name() string       { return f.name }
+func (f testFileInfo) Size() int64        { return f.size }
+func (f testFileInfo) Mode() fs.FileMode  { return 0644 }
+func (f testFileInfo) ModTime() time.Time { return f.modTime }
+func (f testFileInfo) IsDir() bool        { return f.isDir }
+func (f testFileInfo) Sys() interface{}   { return nil }
+func (f testFileInfo) ETag() string       { return f.etag }
+
+func TestUnchanged(t *testing.T) {
+
+	// the compare mode is restored for the other tests
+	defer func(m compareMode, w time.Duration) { compare, mtimeWindow = m, w }(compare, mtimeWindow)
+
+	now := time.Now()
+
+	src := pathFileInfo{path: "/src/a", info: testFileInfo{name: "a", size: 10, modTime: now}}
+
+	cases := []struct {
+		mode   compareMode
+		window time.Duration
+		dst    testFileInfo
+		expect bool
+	}{
+		{compareSizeMtime, 0, testFileInfo{name: "a", size: 10, modTime: now.Add(time.Second)}, true},
+		{compareSizeMtime, 0, testFileInfo{name: "a", size: 10, modTime: now.Add(-time.Second)}, false},
+		{compareSizeMtime, 2 * time.Second, testFileInfo{name: "a", size: 10, modTime: now.Add(-time.Second)}, true},
+		{compareSizeMtime, 0, testFileInfo{name: "a", size: 11, modTime: now.Add(time.Second)}, false},
+		{compareSize, 0, testFileInfo{name: "a", size: 10, modTime: now.Add(-time.Hour)}, true},
+		{compareAlways, 0, testFileInfo{name: "a", size: 10, modTime: now}, false},
+		{compareSize, 0, testFileInfo{name: "a", size: 0, isDir: true}, false},
+	}
+
+	for _, c := range cases {
+		compare = c.mode
+		mtimeWindow = c.window
+		same, err := unchanged(Put, src, pathFileInfo{path: "/dst/a", info: c.dst})
+		if err != nil {
+			t.Errorf("%s\n", err)
+		}
+		if same != c.expect {
+			t.Errorf("mode %s, window %s, dst %+v: expect %t, got %t\n", c.mode, c.window, c.dst, c.expect, same)
+		}
+	}
+
+	// ETags of two repository files are not comparable
+	compare = compareETag
+	srcCopy := pathFileInfo{path: "/src/a", info: testFileInfo{name: "a", etag: `"abc"`}}
+	dstCopy := pathFileInfo{path: "/dst/a", info: testFileInfo{name: "a", etag: `"abc"`}}
+	if _, err := unchanged(Copy, srcCopy, dstCopy); err == nil {
+		t.Errorf("expect error comparing the ETags of two repository files\n")
+	}
+
+	// invalid compare mode
+	var m compareMode
+	if err := m.Set("mtime"); err == nil {
+		t.Errorf("expect error on invalid compare mode\n")
+	}
+}
@@ -0,0 +1,227 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+const (
+	// defaultThreads is the default number of concurrent workers.
+	defaultThreads = 4
+	// minAutoThreads and maxAutoThreads are the bounds of the concurrency in the `auto` mode.
+	minAutoThreads = 1
+	maxAutoThreads = 32
+	// adaptInterval is the interval at which the concurrency is adjusted in the `auto` mode.
+	adaptInterval = 2 * time.Second
+)
+
+// threadsValue is the value of the `--nthreads` flag, which is either a positive number
+// or "auto" for adapting the concurrency to the observed server performance.
+type threadsValue struct {
+	n    int
+	auto bool
+}
+
+// String implements the `pflag.Value` interface.
+func (t *threadsValue) String() string {
+	if t.auto {
+		return "auto"
+	}
+	return strconv.Itoa(t.n)
+}
+
+// Set implements the `pflag.Value` interface.
+func (t *threadsValue) Set(v string) error {
+	if v == "auto" {
+		t.n, t.auto = defaultThreads, true
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be a positive number or \"auto\"")
+	}
+	t.n, t.auto = n, false
+	return nil
+}
+
+// Type implements the `pflag.Value` interface.
+func (t *threadsValue) Type() string {
+	return "number"
+}
+
+// getNumWorkers returns the size of the worker pools.  In the `auto` mode, it is the
+// upper bound of the concurrency, and the workers are gated by the `adaptiveLimiter`.
+func getNumWorkers() int {
+	if nthreads.auto {
+		return maxAutoThreads
+	}
+	return nthreads.n
+}
+
+// limiter is the adaptive concurrency limiter of the current command in the `auto` mode.
+// It is nil if the concurrency is fixed.
+var limiter atomic.Pointer[adaptiveLimiter]
+
+// adaptiveLimiter limits the number of active workers, and adjusts the limit based on the
+// observed throughput, request latency and throttling responses (429/503) of the server.
+//
+// The limit is increased by one as long as the throughput improves, and is decreased by
+// one when the throughput drops or the latency rises significantly.  On throttling
+// responses, the limit is halved.
+type adaptiveLimiter struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+
+	// observations within the current interval
+	work      int64
+	requests  int
+	latency   time.Duration
+	nlatency  int
+	throttled int
+
+	// reference values from the previous intervals
+	lastRate    float64
+	baseLatency time.Duration
+}
+
+// startLimiter starts the adaptive concurrency limiter for the current command if `--nthreads`
+// is set to "auto".  The limiter is stopped when the context `ctx` is done.
+func startLimiter(ctx context.Context) {
+	if !nthreads.auto {
+		limiter.Store(nil)
+		return
+	}
+
+	l := &adaptiveLimiter{limit: defaultThreads}
+	l.cond = sync.NewCond(&l.mutex)
+	limiter.Store(l)
+
+	go func() {
+		ticker := time.NewTicker(adaptInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				l.mutex.Lock()
+				l.cond.Broadcast()
+				l.mutex.Unlock()
+				return
+			case <-ticker.C:
+				l.adapt()
+			}
+		}
+	}()
+}
+
+// acquireWorker blocks until the calling worker is allowed to run by the adaptive limiter,
+// or until the context `ctx` is done.  It returns false if the context is done.
+//
+// It returns true immediately if the concurrency is fixed.
+func acquireWorker(ctx context.Context) bool {
+	l := limiter.Load()
+	if l == nil {
+		return ctx.Err() == nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	l.active++
+	return true
+}
+
+// releaseWorker releases the calling worker with `work` units done, e.g. bytes transferred or
+// number of files operated.
+func releaseWorker(work int64) {
+	l := limiter.Load()
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.active--
+	l.work += work
+	l.cond.Broadcast()
+}
+
+// observeResponse records the status code and latency of a HTTP response.
+func observeResponse(status int, latency time.Duration) {
+	l := limiter.Load()
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.requests++
+	if latency > 0 {
+		l.latency += latency
+		l.nlatency++
+	}
+	if status == 429 || status == 503 {
+		l.throttled++
+	}
+}
+
+// adapt adjusts the concurrency limit based on the observations in the past interval.
+func (l *adaptiveLimiter) adapt() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// nothing happened, e.g. the walker is still listing directories
+	if l.work == 0 && l.requests == 0 {
+		return
+	}
+
+	rate := float64(l.work) / adaptInterval.Seconds()
+
+	var latency time.Duration
+	if l.nlatency > 0 {
+		latency = l.latency / time.Duration(l.nlatency)
+		if l.baseLatency == 0 || latency < l.baseLatency {
+			l.baseLatency = latency
+		}
+	}
+
+	limit := l.limit
+	switch {
+	case l.throttled > 0:
+		limit = limit / 2
+	case l.baseLatency > 0 && latency > 3*l.baseLatency:
+		limit--
+	case rate > 1.05*l.lastRate:
+		limit++
+	case rate < 0.9*l.lastRate:
+		limit--
+	}
+
+	if limit < minAutoThreads {
+		limit = minAutoThreads
+	}
+	if limit > maxAutoThreads {
+		limit = maxAutoThreads
+	}
+
+	if limit != l.limit {
+		log.Debugf("concurrency %d -> %d (rate: %.0f/s, latency: %s, throttled: %d)", l.limit, limit, rate, latency, l.throttled)
+	}
+
+	l.limit = limit
+	l.lastRate = rate
+	l.work, l.requests, l.latency, l.nlatency, l.throttled = 0, 0, 0, 0, 0
+	l.cond.Broadcast()
+}
@@ -0,0 +1,69 @@
+package repocli
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+
+	l := &adaptiveLimiter{limit: defaultThreads}
+	l.cond = sync.NewCond(&l.mutex)
+	limiter.Store(l)
+	defer limiter.Store(nil)
+
+	// observe runs a worker through a file with `work` units done and a response
+	observe := func(work int64, status int, latency time.Duration) {
+		if !acquireWorker(context.Background()) {
+			t.Fatal("worker not acquired")
+		}
+		observeResponse(status, latency)
+		releaseWorker(work)
+	}
+
+	// nothing observed, e.g. while listing directories
+	l.adapt()
+	if l.limit != defaultThreads {
+		t.Errorf("limit changed without observations: %d", l.limit)
+	}
+
+	// the limit grows with the throughput, up to the upper bound
+	work := int64(1000)
+	for i := 0; i < 40; i++ {
+		work = work * 11 / 10
+		observe(work, http.StatusCreated, 10*time.Millisecond)
+		l.adapt()
+	}
+	if l.limit != maxAutoThreads {
+		t.Errorf("expected the limit %d with an increasing rate, got %d", maxAutoThreads, l.limit)
+	}
+
+	// the limit backs off when the latency rises significantly
+	observe(work, http.StatusCreated, 50*time.Millisecond)
+	l.adapt()
+	if l.limit != maxAutoThreads-1 {
+		t.Errorf("expected the limit %d with a latency rise, got %d", maxAutoThreads-1, l.limit)
+	}
+
+	// and when the throughput drops
+	observe(1000, http.StatusCreated, 10*time.Millisecond)
+	l.adapt()
+	if l.limit != maxAutoThreads-2 {
+		t.Errorf("expected the limit %d with a throughput drop, got %d", maxAutoThreads-2, l.limit)
+	}
+
+	// the limit is halved on throttling responses, down to the lower bound
+	for _, expected := range []int{15, 7, 3, 1, 1} {
+		observe(1000, http.StatusTooManyRequests, 10*time.Millisecond)
+		l.adapt()
+		if l.limit != expected {
+			t.Errorf("expected the limit %d after throttling, got %d", expected, l.limit)
+		}
+	}
+	if l.limit < minAutoThreads || l.active != 0 {
+		t.Errorf("unexpected limiter state: limit %d, active %d", l.limit, l.active)
+	}
+}
@@ -0,0 +1,236 @@
+package repocli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	dav "github.com/studio-b12/gowebdav"
+	"golang.org/x/term"
+)
+
+// conflictPolicy is the policy for resolving conflict with an existing destination file
+// that is considered different from the source.
+type conflictPolicy string
+
+const (
+	// conflictSkip keeps the existing destination file and skips the source.
+	conflictSkip conflictPolicy = "skip"
+	// conflictOverwrite overwrites the existing destination file.
+	conflictOverwrite conflictPolicy = "overwrite"
+	// conflictNewer overwrites the existing destination file only if the source is newer.
+	conflictNewer conflictPolicy = "newer"
+	// conflictRename keeps the existing destination file and writes the source into a
+	// new file with a numbered suffix, e.g. "MANIFEST.txt.1".
+	conflictRename conflictPolicy = "rename"
+	// conflictBackup renames the existing destination file with a numbered suffix,
+	// e.g. "MANIFEST.txt.1", and writes the source into the destination.
+	conflictBackup conflictPolicy = "backup"
+	// conflictAsk prompts the user for the policy for every conflicting file.
+	conflictAsk conflictPolicy = "ask"
+)
+
+// conflictPolicies is a list of supported conflict policies.
+var conflictPolicies = []conflictPolicy{conflictSkip, conflictOverwrite, conflictNewer, conflictRename, conflictBackup, conflictAsk}
+
+// String implements the `pflag.Value` interface.
+func (c *conflictPolicy) String() string {
+	return string(*c)
+}
+
+// Set implements the `pflag.Value` interface.
+func (c *conflictPolicy) Set(v string) error {
+	for _, policy := range conflictPolicies {
+		if string(policy) == v {
+			*c = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", joinModes(conflictPolicies))
+}
+
+// Type implements the `pflag.Value` interface.
+func (c *conflictPolicy) Type() string {
+	return "policy"
+}
+
+// onConflict is the conflict policy given by the `--on-conflict` flag. When it is not set,
+// the default policy of the operation is used, see `getConflictPolicy`.
+var onConflict conflictPolicy
+
+// askPolicy keeps the answer of the user for all the subsequent conflicts, and makes sure
+// that concurrent workers prompt the user one at a time.
+var askPolicy struct {
+	mutex sync.Mutex
+	all   conflictPolicy
+}
+
+// addConflictFlags adds the flag for selecting the conflict policy to the command `cmd`.
+func addConflictFlags(cmd *cobra.Command, defaultPolicy conflictPolicy) {
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	onConflict = ""
+	askPolicy.all = ""
+	cmd.Flags().Var(
+		&onConflict,
+		"on-conflict",
+		fmt.Sprintf("`policy` for existing destination files: %s (default \"%s\")", joinModes(conflictPolicies), defaultPolicy),
+	)
+}
+
+// getConflictPolicy returns the conflict policy of the operation `op`.  By default, existing files are
+// overwritten on `Put` and `Get`; and are skipped on `Copy` and `Move`.
+func getConflictPolicy(op Op) conflictPolicy {
+	if onConflict != "" {
+		return onConflict
+	}
+	if op == Copy || op == Move {
+		return conflictSkip
+	}
+	return conflictOverwrite
+}
+
+// resolveConflict applies the conflict policy of the operation `op` on the existing destination `dst`
+// of the source `src`.  Both `src.info` and `dst.info` are expected to be set.
+//
+// It returns the path to which the source should be written, the path to which the existing destination
+// is renamed by the backup policy, whether the source replaces the existing destination at that path,
+// and whether the operation should proceed.  The destination is in the
+// repository for `Put`, `Copy` and `Move`, and at local for `Get`.
+func resolveConflict(op Op, src, dst pathFileInfo) (string, string, bool, bool, error) {
+
+	remote := op != Get
+
+	policy := getConflictPolicy(op)
+	if policy == conflictAsk {
+		if plan != nil {
+			plan.add(planAsk, src.path, dst.path, src.info.Size())
+			return dst.path, "", false, false, nil
+		}
+		policy = askConflictPolicy(dst.path)
+	}
+
+	switch policy {
+	case conflictSkip:
+		log.Debugf("skip existing file: %s", dst.path)
+		if plan != nil {
+			plan.add(planSkip, src.path, dst.path, src.info.Size())
+		}
+		return dst.path, "", false, false, nil
+
+	case conflictOverwrite:
+		return dst.path, "", true, true, nil
+
+	case conflictNewer:
+		if src.info.ModTime().After(dst.info.ModTime()) {
+			return dst.path, "", true, true, nil
+		}
+		log.Debugf("skip existing file not older than the source: %s", dst.path)
+		if plan != nil {
+			plan.add(planSkip, src.path, dst.path, src.info.Size())
+		}
+		return dst.path, "", false, false, nil
+
+	case conflictRename:
+		p, err := nextNumberedPath(dst.path, remote)
+		if err != nil {
+			return dst.path, "", false, false, err
+		}
+		log.Debugf("keep existing file %s, writing to %s", dst.path, p)
+		return p, "", false, true, nil
+
+	case conflictBackup:
+		p, err := nextNumberedPath(dst.path, remote)
+		if err != nil {
+			return dst.path, "", false, false, err
+		}
+		log.Debugf("backup existing file %s to %s", dst.path, p)
+		if plan != nil {
+			plan.add(planBackup, dst.path, p, dst.info.Size())
+			return dst.path, "", false, true, nil
+		}
+		if remote {
+			err = cli.Rename(dst.path, p, false)
+		} else {
+			err = os.Rename(dst.path, p)
+		}
+		if err != nil {
+			return dst.path, "", false, false, fmt.Errorf("cannot backup %s: %s", dst.path, err)
+		}
+		return dst.path, p, false, true, nil
+
+	default:
+		return dst.path, "", false, false, fmt.Errorf("unknown conflict policy: %s", policy)
+	}
+}
+
+// skipReason explains why the source of the operation `op` is skipped on the existing destination
+// `dst` by the conflict policy, for the user to choose another policy.
+func skipReason(op Op, dst string) string {
+	if getConflictPolicy(op) == conflictNewer {
+		return fmt.Sprintf("%s exists and is not older than the source", dst)
+	}
+	return fmt.Sprintf("%s exists, use --on-conflict to replace it", dst)
+}
+
+// askConflictPolicy prompts the user for the policy of resolving the conflict on `p`.
+// The policy defaults to `conflictSkip` when the standard input is not a terminal.
+func askConflictPolicy(p string) conflictPolicy {
+
+	askPolicy.mutex.Lock()
+	defer askPolicy.mutex.Unlock()
+
+	if askPolicy.all != "" {
+		return askPolicy.all
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Warnf("cannot ask for conflict policy without a terminal, skip existing file: %s", p)
+		return conflictSkip
+	}
+
+	answers := map[string]conflictPolicy{
+		"y": conflictOverwrite,
+		"n": conflictSkip,
+		"r": conflictRename,
+		"b": conflictBackup,
+	}
+
+	for {
+		a := stringPrompt(fmt.Sprintf("\n%s exists, overwrite? [y]es/[n]o/[r]ename/[b]ackup (uppercase for all)", p))
+		if policy, ok := answers[strings.ToLower(a)]; ok {
+			if a != strings.ToLower(a) {
+				askPolicy.all = policy
+			}
+			return policy
+		}
+	}
+}
+
+// nextNumberedPath returns the first non-existing path in form of `p.N` with N starting from 1,
+// e.g. "MANIFEST.txt.1".  It checks the repository if `remote` is true, otherwise the local filesystem.
+func nextNumberedPath(p string, remote bool) (string, error) {
+	for i := 1; ; i++ {
+		np := fmt.Sprintf("%s.%d", p, i)
+
+		var err error
+		if remote {
+			_, err = cli.Stat(np)
+			if dav.IsErrNotFound(err) {
+				return np, nil
+			}
+		} else {
+			_, err = os.Lstat(np)
+			if errors.Is(err, os.ErrNotExist) {
+				return np, nil
+			}
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
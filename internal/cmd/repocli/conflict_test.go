@@ -0,0 +1,85 @@
+package repocli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveConflict(t *testing.T) {
+
+	defer func(p conflictPolicy) { onConflict = p }(onConflict)
+
+	now := time.Now()
+	tests := []struct {
+		policy  conflictPolicy
+		srcTime time.Time
+		path    string
+		replace bool
+		proceed bool
+		// backup is the file to which the existing destination is renamed
+		backup string
+	}{
+		{policy: conflictSkip, srcTime: now, path: "f.txt"},
+		{policy: conflictOverwrite, srcTime: now, path: "f.txt", replace: true, proceed: true},
+		{policy: conflictNewer, srcTime: now, path: "f.txt", replace: true, proceed: true},
+		{policy: conflictNewer, srcTime: now.Add(-2 * time.Hour), path: "f.txt"},
+		{policy: conflictRename, srcTime: now, path: "f.txt.2", proceed: true},
+		{policy: conflictBackup, srcTime: now, path: "f.txt", proceed: true, backup: "f.txt.2"},
+	}
+
+	for _, c := range tests {
+		// the destination f.txt exists with f.txt.1, modified an hour ago
+		dir := t.TempDir()
+		for _, name := range []string{"f.txt", "f.txt.1"} {
+			p := filepath.Join(dir, name)
+			if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(p, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dstInfo, _ := os.Stat(filepath.Join(dir, "f.txt"))
+
+		onConflict = c.policy
+		src := pathFileInfo{path: "/data/f.txt", info: testFileInfo{name: "f.txt", size: 1, modTime: c.srcTime}}
+		dst := pathFileInfo{path: filepath.Join(dir, "f.txt"), info: dstInfo}
+		p, backup, replace, proceed, err := resolveConflict(Get, src, dst)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.policy, err)
+			continue
+		}
+		if p != filepath.Join(dir, c.path) || replace != c.replace || proceed != c.proceed {
+			t.Errorf("%s: got %s, %t, %t, expected %s, %t, %t", c.policy, p, replace, proceed, c.path, c.replace, c.proceed)
+		}
+		if c.backup != "" {
+			if backup != filepath.Join(dir, c.backup) {
+				t.Errorf("%s: unexpected backup %s", c.policy, backup)
+			}
+			if b, err := os.ReadFile(filepath.Join(dir, c.backup)); err != nil || string(b) != "f.txt" {
+				t.Errorf("%s: existing file not in %s: %q, %v", c.policy, c.backup, b, err)
+			}
+		}
+	}
+}
+
+func TestNextNumberedPath(t *testing.T) {
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "MANIFEST.txt")
+
+	for _, expected := range []string{"MANIFEST.txt.1", "MANIFEST.txt.2", "MANIFEST.txt.3"} {
+		np, err := nextNumberedPath(p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if np != filepath.Join(dir, expected) {
+			t.Errorf("expected %s, got %s", expected, np)
+		}
+		if err := os.WriteFile(np, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
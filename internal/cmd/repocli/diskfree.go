@@ -0,0 +1,14 @@
+//go:build !windows
+
+package repocli
+
+import "syscall"
+
+// diskFree returns the number of bytes available to the current user on the filesystem of `dir`.
+func diskFree(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
@@ -0,0 +1,16 @@
+package repocli
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the number of bytes available to the current user on the filesystem of `dir`.
+func diskFree(dir string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
@@ -0,0 +1,264 @@
+package repocli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// progressFormat is the format of the progress output: a progress bar on the terminal, or
+// newline-delimited JSON events for other programs.
+type progressFormat string
+
+const (
+	progressBar  progressFormat = "bar"
+	progressJSON progressFormat = "json"
+)
+
+// String implements the `pflag.Value` interface.
+func (f *progressFormat) String() string {
+	return string(*f)
+}
+
+// Set implements the `pflag.Value` interface.
+func (f *progressFormat) Set(v string) error {
+	switch progressFormat(v) {
+	case progressBar, progressJSON:
+		*f = progressFormat(v)
+		return nil
+	}
+	return fmt.Errorf("must be one of \"bar\" or \"json\"")
+}
+
+// Type implements the `pflag.Value` interface.
+func (f *progressFormat) Type() string {
+	return "format"
+}
+
+// progress is the format of the progress output of the current command.
+var progress = progressBar
+
+// progressFd is the file descriptor to which the JSON progress events are written.
+var progressFd int
+
+// progressFiles are the files opened on the file descriptors given by `--progress-fd`.
+var progressFiles = map[int]*os.File{}
+
+// events is the writer of the JSON progress events, or `nil` if the progress is shown as a bar.
+var events *eventWriter
+
+// bytesEventInterval is the minimum interval between two `bytes` events of a file transfer.
+const bytesEventInterval = time.Second
+
+// opNames are the names of the operations in the progress events.
+var opNames = map[Op]string{
+	Put:    "put",
+	Get:    "get",
+	Move:   "move",
+	Remove: "remove",
+	Copy:   "copy",
+}
+
+// progressEvent is a progress event, written as a single line of JSON.  The `event` is one of:
+//
+//   - `job_start`: the operation is started with `workers` concurrent workers.
+//   - `scan`: the directory `src` is listed, with `files` files of `size` bytes to process.
+//   - `file_start`: the operation on the file `src` to `dst` is started.
+//   - `bytes`: `bytes` of the file `src` are transferred.
+//   - `file_done`: the operation on the file `src` is completed.
+//   - `file_failed`: the operation on the file `src` failed with the `error` of the `error_class`.
+//   - `file_conflict`: the file `src` is not written, as the destination is changed by someone else
+//     since it was checked.
+//   - `job_summary`: the operation is finished with the number of files `succeeded` and `failed`,
+//     and `bytes` transferred in `elapsed` seconds.
+type progressEvent struct {
+	Time       string  `json:"time"`
+	Event      string  `json:"event"`
+	Op         string  `json:"op,omitempty"`
+	Src        string  `json:"src,omitempty"`
+	Dst        string  `json:"dst,omitempty"`
+	Size       *int64  `json:"size,omitempty"`
+	Files      *int64  `json:"files,omitempty"`
+	Bytes      *int64  `json:"bytes,omitempty"`
+	Workers    int     `json:"workers,omitempty"`
+	Skipped    bool    `json:"skipped,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	Succeeded  *int    `json:"succeeded,omitempty"`
+	Failed     *int    `json:"failed,omitempty"`
+	Cancelled  bool    `json:"cancelled,omitempty"`
+	Elapsed    float64 `json:"elapsed,omitempty"`
+}
+
+// eventWriter writes the progress events of the current command.  All methods are no-op on a `nil` writer.
+type eventWriter struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+	bytes int64
+}
+
+// newEventWriter returns the writer of the progress events on the file descriptor `fd`.
+func newEventWriter(fd int) (*eventWriter, error) {
+	var w io.Writer
+	switch fd {
+	case 1:
+		w = os.Stdout
+	case 2:
+		w = os.Stderr
+	default:
+		// the file is kept for the next commands in the shell mode, as it closes the descriptor
+		// when garbage collected.
+		f, ok := progressFiles[fd]
+		if !ok {
+			if f = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)); f == nil {
+				return nil, fmt.Errorf("invalid file descriptor: %d", fd)
+			}
+			if _, err := f.Stat(); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor %d: %s", fd, err)
+			}
+			progressFiles[fd] = f
+		}
+		w = f
+	}
+	return &eventWriter{enc: json.NewEncoder(w)}, nil
+}
+
+// emit writes the event `ev` with the current time.
+func (e *eventWriter) emit(ev progressEvent) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	ev.Time = time.Now().Format(time.RFC3339Nano)
+	e.enc.Encode(ev)
+}
+
+// jobStart emits the start of the operation `op` with `nworkers` workers.
+func (e *eventWriter) jobStart(op Op, nworkers int) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	e.start, e.bytes = time.Now(), 0
+	e.mutex.Unlock()
+	e.emit(progressEvent{Event: "job_start", Op: opNames[op], Workers: nworkers})
+}
+
+// scanned emits the listing of the directory `dir` with `files`.
+func (e *eventWriter) scanned(dir string, files []fs.FileInfo) {
+	if e == nil {
+		return
+	}
+	n, size := countFiles(files), countSize(files)
+	e.emit(progressEvent{Event: "scan", Src: dir, Files: &n, Size: &size})
+}
+
+// fileStart emits the start of the operation `op` on the input `in`.
+func (e *eventWriter) fileStart(op Op, in opInput) {
+	if e == nil {
+		return
+	}
+	ev := progressEvent{Event: "file_start", Op: opNames[op], Src: in.src.path, Dst: in.dst.path}
+	if in.src.info != nil && (op == Put || op == Get) {
+		size := in.src.info.Size()
+		ev.Size = &size
+	}
+	e.emit(ev)
+}
+
+// transferred emits the number of `bytes` of the file `src` transferred so far.
+func (e *eventWriter) transferred(src string, bytes int64) {
+	e.emit(progressEvent{Event: "bytes", Src: src, Bytes: &bytes})
+}
+
+// fileDone emits the result `res` of the operation `op` on a file.
+func (e *eventWriter) fileDone(op Op, res opResult) {
+	if e == nil {
+		return
+	}
+	ev := progressEvent{Event: "file_done", Op: opNames[op], Src: res.in.src.path, Dst: res.in.dst.path, Skipped: res.skipped}
+	if op == Put || op == Get {
+		ev.Bytes = &res.bytes
+		e.mutex.Lock()
+		e.bytes += res.bytes
+		e.mutex.Unlock()
+	}
+	if res.err != nil {
+		ev.Event = "file_failed"
+		if errors.Is(res.err, errChangedRemotely) {
+			ev.Event = "file_conflict"
+		}
+		ev.Error = res.err.Error()
+		ev.ErrorClass = errorClass(res.err)
+	}
+	e.emit(ev)
+}
+
+// jobSummary emits the end of the operation `op`, with the number of succeeded and failed files.
+func (e *eventWriter) jobSummary(ctx context.Context, op Op, cntOk, cntErr int) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	bytes, elapsed := e.bytes, time.Since(e.start).Seconds()
+	e.mutex.Unlock()
+	e.emit(progressEvent{
+		Event:     "job_summary",
+		Op:        opNames[op],
+		Succeeded: &cntOk,
+		Failed:    &cntErr,
+		Bytes:     &bytes,
+		Cancelled: ctx.Err() != nil,
+		Elapsed:   elapsed,
+	})
+}
+
+// errorClass classifies the error `err` for the progress events and the reports, e.g. for deciding
+// whether the failed files are worth transferring again.
+func errorClass(err error) string {
+	var se dav.StatusError
+	var ue *url.Error
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &se):
+		switch {
+		case se.Status == http.StatusUnauthorized || se.Status == http.StatusForbidden:
+			return "permission"
+		case se.Status == http.StatusNotFound:
+			return "not_found"
+		case se.Status == http.StatusConflict || se.Status == http.StatusPreconditionFailed:
+			return "conflict"
+		case se.Status == http.StatusInsufficientStorage:
+			return "quota"
+		case se.Status == http.StatusLocked:
+			return "locked"
+		case isRetryableStatus(se.Status):
+			return "server_transient"
+		}
+		return "server"
+	case errors.As(err, &ue) || errors.As(err, &ne):
+		return "network"
+	case isRetryable(err):
+		return "transient"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not_found"
+	}
+	return "other"
+}
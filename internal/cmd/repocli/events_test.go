@@ -0,0 +1,116 @@
+package repocli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	dav "github.com/studio-b12/gowebdav"
+)
+
+func TestEventWriter(t *testing.T) {
+
+	var out bytes.Buffer
+	e := &eventWriter{enc: json.NewEncoder(&out)}
+
+	in := opInput{src: pathFileInfo{path: "/a/f1"}, dst: pathFileInfo{path: "/b/f1"}}
+	e.jobStart(Get, 2)
+	e.fileStart(Get, in)
+	e.transferred("/a/f1", 10)
+	e.fileDone(Get, opResult{in: in, bytes: 20})
+	e.fileDone(Get, opResult{in: in, err: &os.PathError{Op: "ReadStream", Path: "/a/f2", Err: dav.StatusError{Status: 404}}})
+	e.jobSummary(context.Background(), Get, 1, 1)
+
+	var evs []progressEvent
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var ev progressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid event %q: %s", scanner.Text(), err)
+		}
+		evs = append(evs, ev)
+	}
+
+	expected := []string{"job_start", "file_start", "bytes", "file_done", "file_failed", "job_summary"}
+	if len(evs) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(evs))
+	}
+	for i, ev := range evs {
+		if ev.Event != expected[i] {
+			t.Errorf("event %d: expected %s, got %s", i, expected[i], ev.Event)
+		}
+	}
+	if evs[4].ErrorClass != "not_found" {
+		t.Errorf("unexpected error class: %s", evs[4].ErrorClass)
+	}
+	if s := evs[5]; *s.Succeeded != 1 || *s.Failed != 1 || *s.Bytes != 20 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{&os.PathError{Err: dav.StatusError{Status: 403}}, "permission"},
+		{&os.PathError{Err: dav.StatusError{Status: 503}}, "server_transient"},
+		{&os.PathError{Err: dav.StatusError{Status: 501}}, "server"},
+		{fmt.Errorf("put: %w", &url.Error{Op: "Put", Err: errors.New("connection reset")}), "network"},
+		{retryableError{errors.New("size mismatch")}, "transient"},
+		{fmt.Errorf("open: %w", fs.ErrPermission), "permission"},
+		{context.Canceled, "cancelled"},
+		{errors.New("unknown"), "other"},
+	}
+	for _, tt := range tests {
+		if c := errorClass(tt.err); c != tt.class {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.class, c)
+		}
+	}
+}
+
+func TestRunSingleOpEvents(t *testing.T) {
+
+	// the destination is absent, and the server copies the file itself
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PROPFIND":
+			w.WriteHeader(http.StatusNotFound)
+		case "COPY":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	var out bytes.Buffer
+	defer func(e *eventWriter) { events = e }(events)
+	events = &eventWriter{enc: json.NewEncoder(&out)}
+
+	in := opInput{src: pathFileInfo{path: "/data/a.txt", info: testFileInfo{name: "a.txt", size: 1}}, dst: pathFileInfo{path: "/data/b.txt"}}
+	if res := runSingleOp(context.Background(), Copy, in, false); res.err != nil || res.written != "/data/b.txt" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var evs []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var ev progressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid event %q: %s", scanner.Text(), err)
+		}
+		evs = append(evs, ev.Event)
+	}
+	if strings.Join(evs, ",") != "job_start,file_start,file_done,job_summary" {
+		t.Errorf("unexpected events: %v", evs)
+	}
+}
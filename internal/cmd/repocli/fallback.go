@@ -0,0 +1,140 @@
+package repocli
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// serverSideOnly disables streaming a file through the client when the server cannot copy or
+// move it itself.
+var serverSideOnly bool
+
+// addServerSideFlag adds the `--server-side-only` flag to the copy or move command `cmd`.
+func addServerSideFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&serverSideOnly, "server-side-only", "", false, "fail instead of streaming the file through the client when the server cannot copy or move it")
+}
+
+// serverSideError is the error of a COPY or MOVE the server does not support for a file, e.g. across
+// collections stored on different back-ends.  It does not unwrap to the `dav.StatusError`, so that
+// the request is not retried.
+type serverSideError struct {
+	err error
+}
+
+// Error implements the `error` interface.
+func (e serverSideError) Error() string {
+	return e.err.Error()
+}
+
+// asServerSideError returns `err` of a COPY or MOVE as a `serverSideError` if the server cannot
+// copy or move the file itself, i.e. it responds `405 Method Not Allowed`, `501 Not Implemented`,
+// `502 Bad Gateway` or `507 Insufficient Storage`.  Other errors are returned as they are.
+func asServerSideError(err error) error {
+	var se dav.StatusError
+	if !errors.As(err, &se) {
+		return err
+	}
+	switch se.Status {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusBadGateway, http.StatusInsufficientStorage:
+		return serverSideError{err}
+	}
+	return err
+}
+
+// throttleWriter is a `io.Writer` counting the bytes written against the bandwidth limit.
+type throttleWriter struct {
+	ctx context.Context
+}
+
+// Write implements the `io.Writer` interface.
+func (w throttleWriter) Write(p []byte) (int, error) {
+	throttle(w.ctx, len(p))
+	return len(p), nil
+}
+
+// streamCopyOrMove copies or moves the repository file `src` to `dst` through the client, i.e. it
+// downloads the file and uploads it again.  The Overwrite header `ow` applies to `dst` as for a
+// COPY or MOVE.  On `Move`, the source is removed once the copy is in place.
+func streamCopyOrMove(ctx context.Context, op Op, src pathFileInfo, dst string, ow bool) error {
+	if err := withRetry(ctx, "stream "+src.path, func() error { return streamRepoFile(ctx, src, dst, ow) }); err != nil {
+		return err
+	}
+	if op != Move {
+		return nil
+	}
+	return withRetry(ctx, "remove "+src.path, func() error { return cli.Remove(src.path) })
+}
+
+// streamRepoFile downloads the repository file `src` into a local temporary file, and uploads it
+// to a hidden temporary file next to `dst`.  The upload is verified with the size and the MD5
+// checksum of the data downloaded, before it is moved to `dst`.
+func streamRepoFile(ctx context.Context, src pathFileInfo, dst string, ow bool) error {
+
+	// the data is kept in a local file, as the upload needs a seekable body to be resent.
+	spool, err := os.CreateTemp("", "repocli-stream-*")
+	if err != nil {
+		return fmt.Errorf("cannot create local temporary file: %s", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	reader, err := cli.ReadStream(src.path)
+	if err != nil {
+		return fmt.Errorf("cannot open file in repository: %w", err)
+	}
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(spool, h, throttleWriter{ctx}), reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failure reading data from %s: %w", src.path, err)
+	}
+	if n != src.info.Size() {
+		return retryableError{fmt.Errorf("file size %s mis-match: %d != %d", src.path, n, src.info.Size())}
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ptemp := getPartialPathRepo(dst)
+	if err := cli.WriteStream(ptemp, throttledReader{spool, ctx}, src.info.Mode()); err != nil {
+		cli.Remove(ptemp)
+		return fmt.Errorf("cannot write %s to the repository: %w", dst, err)
+	}
+
+	// verify the uploaded copy before it replaces the destination
+	f, err := cli.Stat(ptemp)
+	if err != nil {
+		cli.Remove(ptemp)
+		return fmt.Errorf("cannot stat %s at the repository: %w", ptemp, err)
+	}
+	if f.Size() != n {
+		cli.Remove(ptemp)
+		return retryableError{fmt.Errorf("file size %s mis-match: %d != %d", dst, f.Size(), n)}
+	}
+	if c, err := checksum(ptemp, true); err != nil || c != sum {
+		cli.Remove(ptemp)
+		return retryableError{fmt.Errorf("checksum %s mis-match: %s != %s (%v)", dst, c, sum, err)}
+	}
+
+	fctx, cancel := finalizeContext(ctx)
+	defer cancel()
+	if err := moveRepoIf(fctx, ptemp, dst, precondition{absent: !ow}); err != nil {
+		cli.Remove(ptemp)
+		return fmt.Errorf("cannot move %s to %s: %w", ptemp, dst, err)
+	}
+
+	log.Debugf("streamed %s to %s through the client, md5 %s", src.path, dst, sum)
+	return nil
+}
@@ -0,0 +1,95 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCopyOrRenameFallback(t *testing.T) {
+
+	// a server storing files in memory, which refuses COPY and MOVE of /data/src.txt with 502
+	var mutex sync.Mutex
+	files := map[string][]byte{"/dav/data/src.txt": []byte("some data")}
+
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		p := r.URL.Path
+		switch r.Method {
+		case "GET":
+			if b, ok := files[p]; ok {
+				w.Write(b)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case "PUT":
+			files[p], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			delete(files, p)
+			w.WriteHeader(http.StatusNoContent)
+		case "MKCOL":
+			w.WriteHeader(http.StatusCreated)
+		case "PROPFIND":
+			b, ok := files[p]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>%d</d:getcontentlength></d:prop>
+<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, p, len(b))
+		case "COPY", "MOVE":
+			dst := r.Header.Get("Destination")
+			dst = dst[strings.Index(dst, "/dav/"):]
+			if p == "/dav/data/src.txt" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			if _, ok := files[dst]; ok && r.Header.Get("Overwrite") == "F" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			files[dst] = files[p]
+			if r.Method == "MOVE" {
+				delete(files, p)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	info, err := cli.Stat("/data/src.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := pathFileInfo{path: "/data/src.txt", info: info}
+
+	// the 502 is not retried in the test
+	serverSideOnly, retries.max = true, 0
+	defer func() { retries.max = defaultMaxRetry }()
+	if _, _, _, err := cliCopyOrRename(context.Background(), Move, src, "/data/dst.txt"); err == nil || errorClass(err) != "server_transient" {
+		t.Errorf("expected the server error with --server-side-only, got %v (%s)", err, errorClass(err))
+	}
+	serverSideOnly = false
+
+	if _, _, _, err := cliCopyOrRename(context.Background(), Move, src, "/data/dst.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(files["/dav/data/dst.txt"]) != "some data" {
+		t.Errorf("unexpected content of the destination: %q", files["/dav/data/dst.txt"])
+	}
+	if _, ok := files["/dav/data/src.txt"]; ok {
+		t.Errorf("source not removed after the move")
+	}
+	if len(files) != 1 {
+		t.Errorf("unexpected files left behind: %v", files)
+	}
+}
@@ -0,0 +1,285 @@
+package repocli
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// serverInfo is the information about the capabilities of the WebDAV server and the quota of a
+// repository path, as printed by the `info` command.
+type serverInfo struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Server string `json:"server,omitempty"`
+	// DAVClasses are the compliance classes in the `DAV` header, e.g. "1", "2" and "3".
+	DAVClasses []string `json:"davClasses"`
+	// DAVExtensions are the other entries in the `DAV` header, e.g. "access-control".
+	DAVExtensions []string `json:"davExtensions,omitempty"`
+	Methods       []string `json:"methods,omitempty"`
+	// Locking is set if the server supports locks, i.e. compliance class 2.
+	Locking    bool     `json:"locking"`
+	LockScopes []string `json:"lockScopes,omitempty"`
+	// QuotaAvailable and QuotaUsed are the RFC 4331 quota in bytes, nil if not provided.
+	QuotaAvailable *int64 `json:"quotaAvailableBytes,omitempty"`
+	QuotaUsed      *int64 `json:"quotaUsedBytes,omitempty"`
+	// MaxUploadSize is the maximum size of an upload announced by the server, nil if not announced.
+	MaxUploadSize *int64 `json:"maxUploadSize,omitempty"`
+	// ClockOffset is the offset in seconds of the server clock to the local clock, nil if the
+	// server does not send the `Date` header.
+	ClockOffset *float64 `json:"clockOffset,omitempty"`
+}
+
+// uploadLimitHeaders are the non-standard response headers with which some servers announce the
+// maximum size of an upload.
+var uploadLimitHeaders = []string{"X-Max-Upload-Size", "X-Upload-Max-Size"}
+
+// quotaBody is the body of the PROPFIND request for the quota (RFC 4331) and the lock support.
+const quotaBody = `<d:propfind xmlns:d='DAV:'>
+	<d:prop>
+		<d:quota-available-bytes/>
+		<d:quota-used-bytes/>
+		<d:supportedlock/>
+	</d:prop>
+</d:propfind>`
+
+// davQuotaResponse is the `response` element of a PROPFIND response with the quota.
+type davQuotaResponse struct {
+	Props []struct {
+		Status    string `xml:"DAV: status"`
+		Available string `xml:"DAV: prop>quota-available-bytes"`
+		Used      string `xml:"DAV: prop>quota-used-bytes"`
+		Locks     []struct {
+			Exclusive *struct{} `xml:"DAV: lockscope>exclusive"`
+			Shared    *struct{} `xml:"DAV: lockscope>shared"`
+		} `xml:"DAV: prop>supportedlock>lockentry"`
+	} `xml:"DAV: propstat"`
+}
+
+// davQuota is the quota of a repository path, with nil for the values not provided by the server.
+type davQuota struct {
+	available  *int64
+	used       *int64
+	lockScopes []string
+}
+
+// getQuota returns the quota (RFC 4331) and the supported lock scopes of the repository path `p`.
+func getQuota(ctx context.Context, p string) (davQuota, error) {
+
+	var q davQuota
+
+	header := http.Header{}
+	header.Set("Depth", "0")
+	header.Set("Content-Type", "application/xml;charset=UTF-8")
+	header.Set("Accept", "application/xml,text/xml")
+
+	resp, err := davRequest(ctx, "PROPFIND", p, strings.NewReader(quotaBody), header)
+	if err != nil {
+		return q, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return q, fmt.Errorf("PROPFIND %s: %s", p, resp.Status)
+	}
+
+	var ms struct {
+		Responses []davQuotaResponse `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return q, err
+	}
+
+	// only the first response is about the path itself.
+	if len(ms.Responses) == 0 {
+		return q, nil
+	}
+	for _, props := range ms.Responses[0].Props {
+		// the properties not supported by the server are in a `404 Not Found` propstat.
+		if !strings.Contains(props.Status, "200") {
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(props.Available), 10, 64); err == nil {
+			q.available = &n
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(props.Used), 10, 64); err == nil {
+			q.used = &n
+		}
+		for _, l := range props.Locks {
+			if l.Exclusive != nil {
+				q.lockScopes = append(q.lockScopes, "exclusive")
+			}
+			if l.Shared != nil {
+				q.lockScopes = append(q.lockScopes, "shared")
+			}
+		}
+	}
+	return q, nil
+}
+
+// getServerInfo returns the capabilities of the server with an OPTIONS request, and the quota of the
+// repository path `p`.
+func getServerInfo(ctx context.Context, p string) (serverInfo, error) {
+
+	info := serverInfo{
+		URL:        davBaseURL,
+		Path:       p,
+		DAVClasses: make([]string, 0),
+	}
+
+	t0 := time.Now()
+	resp, err := davRequest(ctx, "OPTIONS", p, nil, http.Header{})
+	if err != nil {
+		return info, err
+	}
+	t1 := time.Now()
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return info, fmt.Errorf("OPTIONS %s: %s", p, resp.Status)
+	}
+
+	info.Server = resp.Header.Get("Server")
+	for _, v := range splitHeader(resp.Header.Values("DAV")) {
+		if _, err := strconv.Atoi(v); err == nil {
+			info.DAVClasses = append(info.DAVClasses, v)
+		} else {
+			info.DAVExtensions = append(info.DAVExtensions, v)
+		}
+		info.Locking = info.Locking || v == "2"
+	}
+	info.Methods = splitHeader(resp.Header.Values("Allow"))
+
+	for _, h := range uploadLimitHeaders {
+		if n, err := strconv.ParseInt(resp.Header.Get(h), 10, 64); err == nil {
+			info.MaxUploadSize = &n
+			break
+		}
+	}
+
+	// the `Date` header has a resolution of a second, and is compared to the local time halfway
+	// the request.
+	if d, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		local := t0.Add(t1.Sub(t0) / 2)
+		offset := d.Add(500 * time.Millisecond).Sub(local).Seconds()
+		info.ClockOffset = &offset
+	}
+
+	if q, err := getQuota(ctx, p); err == nil {
+		info.QuotaAvailable, info.QuotaUsed, info.LockScopes = q.available, q.used, q.lockScopes
+	} else {
+		log.Debugf("quota of %s not available: %s", p, err)
+	}
+
+	return info, nil
+}
+
+// splitHeader splits the comma-separated values of the header `vals`.
+func splitHeader(vals []string) []string {
+	items := make([]string, 0)
+	for _, v := range vals {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// writeServerInfo writes the server information `info` to `w`, in JSON if `output` is `outputJSON`.
+func writeServerInfo(w io.Writer, info serverInfo) error {
+
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	optSize := func(n *int64) string {
+		if n == nil {
+			return "unknown"
+		}
+		return formatSize(*n)
+	}
+
+	fmt.Fprintf(w, "%-16s %s\n", "url:", info.URL)
+	fmt.Fprintf(w, "%-16s %s\n", "path:", info.Path)
+	if info.Server != "" {
+		fmt.Fprintf(w, "%-16s %s\n", "server:", info.Server)
+	}
+	fmt.Fprintf(w, "%-16s %s\n", "DAV classes:", strings.Join(info.DAVClasses, ", "))
+	if len(info.DAVExtensions) > 0 {
+		fmt.Fprintf(w, "%-16s %s\n", "DAV extensions:", strings.Join(info.DAVExtensions, ", "))
+	}
+	if len(info.Methods) > 0 {
+		fmt.Fprintf(w, "%-16s %s\n", "methods:", strings.Join(info.Methods, ", "))
+	}
+	locking := yesNo[info.Locking]
+	if len(info.LockScopes) > 0 {
+		locking += " (" + strings.Join(info.LockScopes, ", ") + ")"
+	}
+	fmt.Fprintf(w, "%-16s %s\n", "locking:", locking)
+	fmt.Fprintf(w, "%-16s %s\n", "quota used:", optSize(info.QuotaUsed))
+	fmt.Fprintf(w, "%-16s %s\n", "quota available:", optSize(info.QuotaAvailable))
+	fmt.Fprintf(w, "%-16s %s\n", "max upload size:", optSize(info.MaxUploadSize))
+	if info.ClockOffset != nil {
+		fmt.Fprintf(w, "%-16s %+.1fs\n", "clock offset:", *info.ClockOffset)
+	} else {
+		fmt.Fprintf(w, "%-16s %s\n", "clock offset:", "unknown")
+	}
+	return nil
+}
+
+// command to show the capabilities of the server and the quota of a repository path.
+func infoCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "info [<repo_dir>]",
+		Short: "show the capabilities of the server and the quota of a repository directory",
+		Long: `
+The "info" subcommand shows the capabilities of the WebDAV server and the quota of a repository directory.
+
+The optional argument is used to specify the directory in the repository, in form of an absolute or relative WebDAV path with the path separator "/".  If no argument is provided, the current directory is used.
+
+It shows the WebDAV compliance classes and extensions, the supported methods and locks, the used and available quota (RFC 4331), the maximum size of an upload if announced by the server, and the offset of the server clock to the local clock.  Values not provided by the server are shown as "unknown", or left out of the JSON output.
+		`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if output != outputText && output != outputJSON {
+				return fmt.Errorf("--output %s not supported, must be one of \"text\" or \"json\"", output)
+			}
+
+			p := cwd
+			if len(args) == 1 {
+				p = getCleanRepoPath(args[0])
+			}
+
+			info, err := getServerInfo(cmd.Context(), p)
+			if err != nil {
+				return err
+			}
+			return writeServerInfo(os.Stdout, info)
+		},
+	}
+
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	output = outputText
+	cmd.Flags().VarP(&output, "output", "o", "output `format`: \"text\" or \"json\"")
+	cmd.Flags().BoolVarP(&humanSizes, "human-readable", "", false, "print sizes in human readable format, e.g. 1.5K, 234M, 2G")
+
+	return cmd
+}
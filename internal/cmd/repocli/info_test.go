@@ -0,0 +1,77 @@
+package repocli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerInfo(t *testing.T) {
+
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "OPTIONS":
+			w.Header().Set("DAV", "1, 2, 3, access-control")
+			w.Header().Set("Allow", "OPTIONS, GET, PUT, PROPFIND, LOCK, UNLOCK")
+			w.Header().Set("X-Max-Upload-Size", "1048576")
+			w.Header().Set("Date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		case "PROPFIND":
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dav/data/</d:href><d:propstat><d:prop>
+<d:quota-available-bytes>1000</d:quota-available-bytes><d:quota-used-bytes>24</d:quota-used-bytes>
+<d:supportedlock><d:lockentry><d:lockscope><d:exclusive/></d:lockscope><d:locktype><d:write/></d:locktype></d:lockentry></d:supportedlock>
+</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+</d:multistatus>`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	info, err := getServerInfo(context.Background(), "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(info.DAVClasses, ",") != "1,2,3" || strings.Join(info.DAVExtensions, ",") != "access-control" {
+		t.Errorf("unexpected DAV classes %v and extensions %v", info.DAVClasses, info.DAVExtensions)
+	}
+	if !info.Locking || strings.Join(info.LockScopes, ",") != "exclusive" {
+		t.Errorf("unexpected locking %v with scopes %v", info.Locking, info.LockScopes)
+	}
+	if info.QuotaAvailable == nil || *info.QuotaAvailable != 1000 || info.QuotaUsed == nil || *info.QuotaUsed != 24 {
+		t.Errorf("unexpected quota %v, %v", info.QuotaAvailable, info.QuotaUsed)
+	}
+	if info.MaxUploadSize == nil || *info.MaxUploadSize != 1048576 {
+		t.Errorf("unexpected max upload size %v", info.MaxUploadSize)
+	}
+	if info.ClockOffset == nil || *info.ClockOffset < 58 || *info.ClockOffset > 62 {
+		t.Errorf("unexpected clock offset %v", info.ClockOffset)
+	}
+
+	var b bytes.Buffer
+	output = outputJSON
+	defer func() { output = outputText }()
+	if err := writeServerInfo(&b, info); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"quotaAvailableBytes": 1000`) {
+		t.Errorf("unexpected JSON output: %s", b.String())
+	}
+
+	// the command runs through cobra, which registers the flags with the help flag
+	defer func() { humanSizes = false }()
+	for _, args := range [][]string{{"--help"}, {"--human-readable", "/data"}} {
+		cmd := infoCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		if err := cmd.Execute(); err != nil {
+			t.Errorf("info %v: %s", args, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// journalKey is the key of the last operation in the "journal" bucket of the state database.
+const journalKey = "last"
+
+// journalMove is a move of the repository path `From` to `To` made by an operation.
+type journalMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// journalEntry is an operation of the "mv" or "rm" subcommand recorded for "undo".
+type journalEntry struct {
+	Op    string        `json:"op"`
+	Time  time.Time     `json:"time"`
+	Moves []journalMove `json:"moves,omitempty"`
+	// Trash is the trash folder and Item the ID of the item removed into the trash.
+	Trash string `json:"trash,omitempty"`
+	Item  string `json:"item,omitempty"`
+	// Irreversible explains why the operation cannot be undone, e.g. a permanent removal.
+	Irreversible string `json:"irreversible,omitempty"`
+}
+
+// recordOperation records `e` as the last operation in the journal.  Operations in the dry-run
+// mode are not recorded.  A failure to record is only logged, as the operation is done.
+func recordOperation(e journalEntry) {
+	if plan != nil {
+		return
+	}
+	e.Time = time.Now()
+	if err := setState("journal", journalKey, &e); err != nil {
+		log.Warnf("cannot record %s in the journal: %s", e.Op, err)
+	}
+}
+
+// undoOperation reverses the last operation in the journal by moving the paths back, and removes
+// it from the journal.  A path is not moved back if its original path is taken in the meantime.
+func undoOperation(ctx context.Context) (e journalEntry, err error) {
+
+	if err = getState("journal", journalKey, &e); err != nil {
+		return e, fmt.Errorf("no operation to undo")
+	}
+	if e.Irreversible != "" {
+		return e, fmt.Errorf("cannot undo %s of %s: %s", e.Op, e.Time.Format(time.RFC3339), e.Irreversible)
+	}
+
+	var errs []error
+	for i := len(e.Moves) - 1; i >= 0; i-- {
+		m := e.Moves[i]
+		log.Debugf("moving %s back to %s", m.To, m.From)
+		if err := moveRepoIf(ctx, m.To, m.From, precondition{absent: true}); err != nil {
+			if errors.Is(err, errChangedRemotely) {
+				err = fmt.Errorf("cannot move %s back: %s exists", m.To, m.From)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		return
+	}
+	if e.Trash != "" && e.Item != "" {
+		trashItem := path.Join(e.Trash, e.Item)
+		if err := withRetry(ctx, "remove "+trashItem, func() error { return cli.RemoveAll(trashItem) }); err != nil {
+			log.Warnf("cannot remove %s from the trash: %s", trashItem, err)
+		}
+	}
+	return e, deleteState("journal", journalKey)
+}
+
+// command to undo the last "mv" or "rm".
+func undoCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "undo the last mv or rm in the repository",
+		Long: `
+The "undo" subcommand reverses the last "mv", or "rm --trash", recorded in the operation journal of repocli.  Moved files and directories are moved back to their original path, and items removed into the trash are restored.  A file or directory is not moved back if another one is created at its original path in the meantime.
+
+An "rm" without the "--trash" flag removes files permanently, which cannot be undone.
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			e, err := undoOperation(cmd.Context())
+			if err != nil {
+				return err
+			}
+			for _, m := range e.Moves {
+				log.Infof("moved %s back to %s", m.To, m.From)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,270 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// byteSize is a number of bytes given with an optional unit suffix K, M, G or T (powers of 1024),
+// e.g. "500G".
+type byteSize int64
+
+// parseByteSize parses the number of bytes in `s`, e.g. "10M".
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mul := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			mul = int64(1) << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(v * float64(mul)), nil
+}
+
+// String implements the `pflag.Value` interface.
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return humanizeBytes(int64(*b))
+}
+
+// Set implements the `pflag.Value` interface.
+func (b *byteSize) Set(v string) error {
+	n, err := parseByteSize(v)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+// Type implements the `pflag.Value` interface.
+func (b *byteSize) Type() string {
+	return "bytes"
+}
+
+// bwSlot is the bandwidth limit in bytes per second starting from a time of the day, given in
+// minutes after midnight.  A zero `rate` means no limit.
+type bwSlot struct {
+	at   int
+	rate int64
+}
+
+// bwSchedule is the value of the `--bwlimit` flag.  It is either a single rate, e.g. "10M", or
+// a time-of-day schedule of rates, e.g. "08:00,10M 18:00,off".
+type bwSchedule struct {
+	spec  string
+	slots []bwSlot
+}
+
+// String implements the `pflag.Value` interface.
+func (s *bwSchedule) String() string {
+	return s.spec
+}
+
+// Set implements the `pflag.Value` interface.
+func (s *bwSchedule) Set(v string) error {
+	slots := make([]bwSlot, 0)
+	for _, f := range strings.Fields(v) {
+		at, r, timed := strings.Cut(f, ",")
+		if !timed {
+			r, at = at, "00:00"
+		}
+
+		t, err := time.Parse("15:04", at)
+		if err != nil {
+			return fmt.Errorf("invalid time of the day: %s", at)
+		}
+
+		var rate int64
+		if r != "off" {
+			if rate, err = parseByteSize(r); err != nil {
+				return err
+			}
+		}
+
+		slot := bwSlot{at: t.Hour()*60 + t.Minute(), rate: rate}
+		if len(slots) > 0 && slot.at <= slots[len(slots)-1].at {
+			return fmt.Errorf("times of the day should be in ascending order: %s", v)
+		}
+		slots = append(slots, slot)
+	}
+	s.spec, s.slots = v, slots
+	return nil
+}
+
+// Type implements the `pflag.Value` interface.
+func (s *bwSchedule) Type() string {
+	return "rate"
+}
+
+// rate returns the bandwidth limit at time `t`.  Before the first slot of the day, the last slot
+// of the previous day applies.
+func (s *bwSchedule) rate(t time.Time) int64 {
+	if len(s.slots) == 0 {
+		return 0
+	}
+	m := t.Hour()*60 + t.Minute()
+	rate := s.slots[len(s.slots)-1].rate
+	for _, slot := range s.slots {
+		if slot.at > m {
+			break
+		}
+		rate = slot.rate
+	}
+	return rate
+}
+
+var bwlimit bwSchedule
+
+// bucket is the token bucket shared by all workers for limiting the total bandwidth.  The tokens
+// may go negative, so that the workers wait in turn for the data already transferred.
+var bucket struct {
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// budget stops the current command once the data transferred or the run time exceeds the limits
+// of the `--max-transfer` and `--max-duration` flags.
+var budget struct {
+	maxTransfer byteSize
+	maxDuration time.Duration
+
+	transferred atomic.Int64
+	cancel      context.CancelFunc
+	once        *sync.Once
+}
+
+// addLimitFlags adds the flags for limiting the bandwidth and the transfer budgets to the command `cmd`.
+func addLimitFlags(cmd *cobra.Command) {
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	bwlimit = bwSchedule{}
+	budget.maxTransfer = 0
+	cmd.Flags().Var(&bwlimit, "bwlimit", "limit the total bandwidth in bytes per second, e.g. \"10M\", or by the time of the day, e.g. \"08:00,10M 18:00,off\"")
+	cmd.Flags().Var(&budget.maxTransfer, "max-transfer", "stop gracefully after transferring the given amount of data, e.g. \"500G\"")
+	cmd.Flags().DurationVarP(&budget.maxDuration, "max-duration", "", 0, "stop gracefully after the given run time, e.g. \"8h\"")
+}
+
+// startBudget starts counting the transfer budgets of the current command, which is cancelled by
+// `cancel` when one of the budgets is exhausted.  The transfers in progress are completed, and the
+// command can be resumed by running it again.
+func startBudget(ctx context.Context, cancel context.CancelFunc) {
+	budget.transferred.Store(0)
+	budget.cancel = cancel
+	budget.once = &sync.Once{}
+
+	if budget.maxDuration > 0 {
+		go func() {
+			timer := time.NewTimer(budget.maxDuration)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+			case <-timer.C:
+				stopBudget(fmt.Sprintf("maximum duration %s reached", budget.maxDuration))
+			}
+		}()
+	}
+}
+
+// stopBudget cancels the current command because of the exhausted budget given by `reason`.
+func stopBudget(reason string) {
+	if budget.cancel == nil {
+		return
+	}
+	budget.once.Do(func() {
+		log.Warnf("%s, stopping after the transfers in progress; run the same command again to resume", reason)
+		budget.cancel()
+	})
+}
+
+// finalizeTimeout is the maximum time of the request finalizing a transfer after the command is
+// cancelled.
+const finalizeTimeout = time.Minute
+
+// detachedContext is a context with the values of its parent context, but which is not cancelled
+// with it.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// finalizeContext returns the context of the request finalizing a transfer of which the data is
+// completely sent, e.g. the MOVE of the uploaded temporary file to its final name.  The transfers in
+// progress are completed when the budget is exhausted, so the request is not cancelled with `ctx`, but
+// it is given at most `finalizeTimeout`.
+func finalizeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, finalizeTimeout)
+}
+
+// throttle accounts `n` bytes transferred, and waits until the bandwidth limit allows the transfer
+// to continue, or until `ctx` is done.
+func throttle(ctx context.Context, n int) {
+	if n <= 0 {
+		return
+	}
+
+	if budget.maxTransfer > 0 && budget.transferred.Add(int64(n)) >= int64(budget.maxTransfer) {
+		stopBudget(fmt.Sprintf("maximum transfer %s reached", &budget.maxTransfer))
+	}
+
+	now := time.Now()
+	rate := float64(bwlimit.rate(now))
+	if rate <= 0 {
+		return
+	}
+
+	bucket.mutex.Lock()
+	if !bucket.last.IsZero() {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+	}
+	// allow a burst of one second of data
+	if bucket.tokens > rate {
+		bucket.tokens = rate
+	}
+	bucket.last = now
+	bucket.tokens -= float64(n)
+	wait := time.Duration(-bucket.tokens / rate * float64(time.Second))
+	bucket.mutex.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+}
+
+// throttledReader is a `io.ReadSeeker` reading through the bandwidth limit.  It keeps the source
+// seekable, so that the WebDAV client can rewind it instead of buffering the data for a retry.
+type throttledReader struct {
+	io.ReadSeeker
+	ctx context.Context
+}
+
+// Read implements the `io.Reader` interface.
+func (r throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	throttle(r.ctx, n)
+	return n, err
+}
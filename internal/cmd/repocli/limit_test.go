@@ -0,0 +1,121 @@
+package repocli
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":     0,
+		"512":   512,
+		"10K":   10 * 1024,
+		"10M":   10 * 1024 * 1024,
+		"1.5G":  3 * 512 * 1024 * 1024,
+		"2tb":   2 << 40,
+		" 3MB ": 3 * 1024 * 1024,
+	}
+	for s, expected := range cases {
+		n, err := parseByteSize(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", s, err)
+			continue
+		}
+		if n != expected {
+			t.Errorf("%q: expected %d, got %d", s, expected, n)
+		}
+	}
+
+	for _, s := range []string{"", "M", "ten", "-1K"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestBwSchedule(t *testing.T) {
+
+	at := func(hm string) time.Time {
+		t, _ := time.Parse("15:04", hm)
+		return t
+	}
+
+	var s bwSchedule
+	if err := s.Set("08:00,10M 18:00,off"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]int64{
+		"00:30": 0,
+		"07:59": 0,
+		"08:00": 10 * 1024 * 1024,
+		"12:00": 10 * 1024 * 1024,
+		"18:00": 0,
+		"23:59": 0,
+	}
+	for hm, expected := range cases {
+		if r := s.rate(at(hm)); r != expected {
+			t.Errorf("%s: expected rate %d, got %d", hm, expected, r)
+		}
+	}
+
+	if err := s.Set("1M"); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.rate(at("13:00")); r != 1024*1024 {
+		t.Errorf("expected constant rate %d, got %d", 1024*1024, r)
+	}
+
+	for _, v := range []string{"18:00,1M 08:00,off", "25:00,1M", "08:00,fast"} {
+		if err := s.Set(v); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
+func TestFinalizeContext(t *testing.T) {
+
+	var methods []string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	// the budget is exhausted while the data of the upload is sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fctx, fcancel := finalizeContext(ctx)
+	defer fcancel()
+	if _, ok := fctx.Deadline(); !ok || fctx.Err() != nil {
+		t.Errorf("unexpected finalize context: %v", fctx.Err())
+	}
+	if err := moveRepoIf(fctx, "/data/.f.txt.partial", "/data/f.txt", precondition{absent: true}); err != nil {
+		t.Errorf("finalizing MOVE failed: %s", err)
+	}
+	if len(methods) != 1 || methods[0] != "MOVE" {
+		t.Errorf("unexpected requests: %v", methods)
+	}
+}
+
+func TestThrottleCancel(t *testing.T) {
+
+	defer func() {
+		bwlimit = bwSchedule{}
+		bucket.tokens, bucket.last = 0, time.Time{}
+	}()
+	if err := bwlimit.Set("1K"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wait for 1 MiB at 1 KiB/s ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	throttle(ctx, 1<<20)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("throttle not cancelled, waited %s", d)
+	}
+}
@@ -0,0 +1,384 @@
+package repocli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// outputFormat is the format of the output of the listing commands.
+type outputFormat string
+
+const (
+	// outputText is the human-readable listing, with the details if `--long` is set.
+	outputText outputFormat = "text"
+	// outputJSON is a JSON array of the entries.
+	outputJSON outputFormat = "json"
+	// outputNDJSON is a JSON object per entry on every line.
+	outputNDJSON outputFormat = "ndjson"
+	// outputCSV is a CSV row per entry, after a header row.
+	outputCSV outputFormat = "csv"
+)
+
+// outputFormats is a list of supported output formats.
+var outputFormats = []outputFormat{outputText, outputJSON, outputNDJSON, outputCSV}
+
+// String implements the `pflag.Value` interface.
+func (o *outputFormat) String() string {
+	return string(*o)
+}
+
+// Set implements the `pflag.Value` interface.
+func (o *outputFormat) Set(v string) error {
+	for _, f := range outputFormats {
+		if string(f) == v {
+			*o = f
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", joinModes(outputFormats))
+}
+
+// Type implements the `pflag.Value` interface.
+func (o *outputFormat) Type() string {
+	return "format"
+}
+
+// output is the output format of the current listing command.
+var output = outputText
+
+// listFormat is the Go template with which every entry is printed, instead of the `output` format.
+var listFormat string
+
+// options of the listing commands
+var listRecursive bool
+var listAll bool
+var sortBySize bool
+var sortByTime bool
+var sortReverse bool
+var humanSizes bool
+
+// addListingFlags adds the flags of the listing and of the output format to the listing command `cmd`.
+func addListingFlags(cmd *cobra.Command) {
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	output = outputText
+	cmd.Flags().VarP(&output, "output", "o", fmt.Sprintf("output `format`: %s", joinModes(outputFormats)))
+	cmd.Flags().StringVarP(&listFormat, "format", "", "", "print every entry with the Go `template`, e.g. '{{.Path}}\\t{{.Size}}', with the fields Name, Path, Size, Mtime, IsDir, ETag, ContentType and Privileges")
+	cmd.Flags().BoolVarP(&listRecursive, "recursive", "R", false, "list sub-directories recursively")
+	cmd.Flags().BoolVarP(&listAll, "all", "a", false, "show hidden entries, i.e. with the name starting with \".\"")
+	cmd.Flags().BoolVarP(&sortBySize, "sort-size", "S", false, "sort by size, largest first")
+	cmd.Flags().BoolVarP(&sortByTime, "sort-time", "t", false, "sort by modification time, newest first")
+	cmd.Flags().BoolVarP(&sortReverse, "reverse", "r", false, "reverse the order of the sort")
+	cmd.Flags().BoolVarP(&humanSizes, "human-readable", "", false, "print sizes in human readable format, e.g. 1.5K, 234M, 2G")
+}
+
+// listEntry is an entry of a listing, with the fields available in the JSON and CSV outputs and
+// in the templates of `--format`.
+type listEntry struct {
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	Mtime       time.Time `json:"mtime"`
+	IsDir       bool      `json:"isDir"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	// Privileges are the WebDAV privileges of the current user on a repository entry, see `privilegeSet`.
+	Privileges string `json:"privileges,omitempty"`
+	mode       fs.FileMode
+	// display is the name shown in the short text format, the path relative to the listed
+	// directory in a recursive listing.
+	display string
+}
+
+// newListEntry returns the entry of the file `info` at the path `p`.
+func newListEntry(p string, info fs.FileInfo) listEntry {
+	e := listEntry{
+		Name:    info.Name(),
+		Path:    p,
+		Size:    info.Size(),
+		Mtime:   info.ModTime(),
+		IsDir:   info.IsDir(),
+		ETag:    getETag(info),
+		mode:    info.Mode(),
+		display: info.Name(),
+	}
+	if f, ok := info.(interface{ ContentType() string }); ok {
+		e.ContentType = f.ContentType()
+	}
+	return e
+}
+
+// modeString returns the type and the privileges of a repository entry, e.g. `drwbu`, or the mode
+// of a local entry.
+func (e listEntry) modeString() string {
+	if e.Privileges == "" {
+		return e.mode.String()
+	}
+	if e.IsDir {
+		return "d" + e.Privileges
+	}
+	return "-" + e.Privileges
+}
+
+// csvListHeader is the header of the CSV output.
+var csvListHeader = []string{"name", "path", "size", "mtime", "is_dir", "etag", "content_type", "privileges"}
+
+// listStyle is the style of the text output.
+type listStyle struct {
+	// color colours the names by the type of the entries.
+	color bool
+	// footer adds the number of entries and their total size.
+	footer bool
+}
+
+// printEntries sorts and prints the `entries` to the stdout in the format given by `output` or
+// `listFormat`.  On a terminal, the text output is coloured, unless `NO_COLOR` is set, and ends
+// with a summary footer.
+func printEntries(entries []listEntry) error {
+	sortEntries(entries)
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	return writeEntries(os.Stdout, entries, listStyle{
+		color:  tty && os.Getenv("NO_COLOR") == "",
+		footer: tty,
+	})
+}
+
+// writeEntries writes the `entries` to `w` in the format given by `output` or `listFormat`, and
+// in the `style` for the text output.
+func writeEntries(w io.Writer, entries []listEntry, style listStyle) error {
+
+	if listFormat != "" {
+		if output != outputText {
+			return fmt.Errorf("--format cannot be combined with --output %s", output)
+		}
+		tmpl, err := template.New("format").Parse(listFormat)
+		if err != nil {
+			return fmt.Errorf("invalid format: %s", err)
+		}
+		// the entries for which the template renders nothing are left out, e.g. for filtering
+		var b strings.Builder
+		for _, e := range entries {
+			b.Reset()
+			if err := tmpl.Execute(&b, e); err != nil {
+				return err
+			}
+			if b.Len() > 0 {
+				fmt.Fprintln(w, b.String())
+			}
+		}
+		return nil
+	}
+
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvListHeader)
+		for _, e := range entries {
+			cw.Write([]string{
+				e.Name,
+				e.Path,
+				strconv.FormatInt(e.Size, 10),
+				e.Mtime.Format(time.RFC3339),
+				strconv.FormatBool(e.IsDir),
+				e.ETag,
+				e.ContentType,
+				e.Privileges,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	var ndirs, nfiles int
+	var total int64
+	for _, e := range entries {
+		if e.IsDir {
+			ndirs++
+		} else {
+			nfiles++
+			total += e.Size
+		}
+
+		if longformat {
+			fmt.Fprintf(w, "%11s %12s %s %s\n", e.modeString(), formatSize(e.Size), e.Mtime.Format(time.UnixDate), colorize(e, e.Path, style.color))
+			continue
+		}
+		name := e.display
+		if name == "" {
+			name = e.Name
+		}
+		if e.IsDir && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		fmt.Fprintln(w, colorize(e, name, style.color))
+	}
+
+	if style.footer {
+		// the unit is in the human-readable size, e.g. 1.5K
+		size := formatSize(total)
+		if !humanSizes || total < 1024 {
+			size += " bytes"
+		}
+		fmt.Fprintf(w, "%d directories, %d files, %s in total\n", ndirs, nfiles, size)
+	}
+	return nil
+}
+
+// sortEntries sorts the `entries` by name, or by size or time if `sortBySize` or `sortByTime` is
+// set, in the reverse order if `sortReverse` is set.  In a recursive listing, the entries are
+// grouped by directory.
+func sortEntries(entries []listEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if listRecursive {
+			if da, db := parentDir(a.display), parentDir(b.display); da != db {
+				return da < db
+			}
+		}
+		if sortReverse {
+			a, b = b, a
+		}
+		switch {
+		case sortBySize && a.Size != b.Size:
+			return a.Size > b.Size
+		case sortByTime && !a.Mtime.Equal(b.Mtime):
+			return a.Mtime.After(b.Mtime)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// parentDir returns the parent of the relative path `p`, with either separator.
+func parentDir(p string) string {
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+// formatSize formats the size `n` in bytes, or in the human readable format with the units of
+// 1024 bytes if `humanSizes` is set.
+func formatSize(n int64) string {
+	if !humanSizes || n < 1024 {
+		return strconv.FormatInt(n, 10)
+	}
+	v := float64(n)
+	unit := 0
+	for v >= 1024 && unit < len(sizeUnits)-1 {
+		v /= 1024
+		unit++
+	}
+	if v < 10 {
+		return fmt.Sprintf("%.1f%s", v, sizeUnits[unit])
+	}
+	return fmt.Sprintf("%.0f%s", v, sizeUnits[unit])
+}
+
+// sizeUnits are the units of the human readable sizes.
+var sizeUnits = []string{"", "K", "M", "G", "T", "P"}
+
+// ANSI colours of the entries
+const (
+	colorDir   = "\033[1;34m"
+	colorLink  = "\033[36m"
+	colorExec  = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// colorize colours the `name` of the entry `e` by its type, if `color` is set.
+func colorize(e listEntry, name string, color bool) string {
+	if !color {
+		return name
+	}
+	switch {
+	case e.IsDir:
+		return colorDir + name + colorReset
+	case e.mode&fs.ModeSymlink != 0:
+		return colorLink + name + colorReset
+	case e.mode&0111 != 0:
+		return colorExec + name + colorReset
+	}
+	return name
+}
+
+// isHidden checks whether the file `f` is hidden, i.e. its name starts with a dot.
+func isHidden(f fs.FileInfo) bool {
+	return strings.HasPrefix(f.Name(), ".")
+}
+
+// listEntries returns the entries of the directory `dir`, listed with `list`.  If `listRecursive` is
+// set, the entries of the sub-directories are included, with the `display` path joined by `join`.
+// The hidden entries are left out, unless `listAll` is set.  If a sub-directory cannot be listed, it
+// returns the entries listed with the error.
+func listEntries(ctx context.Context, dir string, w treeWalker, join func(elem ...string) string) ([]listEntry, error) {
+
+	if !listRecursive {
+		files, err := w.list(dir)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]listEntry, 0, len(files))
+		for _, f := range files {
+			if listAll || !isHidden(f) {
+				entries = append(entries, newListEntry(w.joinSrc(dir, f.Name()), f))
+			}
+		}
+		return entries, nil
+	}
+
+	var mutex sync.Mutex
+	entries := make([]listEntry, 0)
+
+	w.joinDst = join
+	w.onList = func(d opInput, files []fs.FileInfo) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, f := range files {
+			if listAll || !isHidden(f) {
+				e := newListEntry(w.joinSrc(d.src.path, f.Name()), f)
+				e.display = join(d.dst.path, f.Name())
+				entries = append(entries, e)
+			}
+		}
+	}
+	// hidden directories are not descended into
+	w.onDir = func(d opInput) bool {
+		return listAll || !isHidden(d.src.info)
+	}
+
+	// the files are pushed by the walker for the operations, which are not needed for listing.
+	ichan := make(chan opInput, opQueueSize)
+	go func() {
+		for range ichan {
+		}
+	}()
+	err := w.walk(ctx, opInput{src: pathFileInfo{path: dir}, dst: pathFileInfo{path: "."}}, ichan)
+	close(ichan)
+
+	return entries, err
+}
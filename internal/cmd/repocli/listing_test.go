@@ -0,0 +1,212 @@
+package repocli
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestWriteEntries(t *testing.T) {
+
+	mtime := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []listEntry{
+		{Name: "sub 01", Path: "/dccn/raw/sub 01", IsDir: true, Mtime: mtime},
+		{Name: "data.nii", Path: "/dccn/raw/data.nii", Size: 1024, Mtime: mtime, ETag: `"abc"`, ContentType: "application/octet-stream"},
+	}
+
+	defer func() { output, listFormat = outputText, "" }()
+
+	var out bytes.Buffer
+
+	// template, with the entries rendering nothing left out
+	listFormat = "{{if .IsDir}}{{.Path}}{{end}}"
+	if err := writeEntries(&out, entries, listStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "/dccn/raw/sub 01\n" {
+		t.Errorf("unexpected template output: %q", out.String())
+	}
+
+	// template cannot be combined with another output format
+	output = outputJSON
+	if err := writeEntries(&out, entries, listStyle{}); err == nil {
+		t.Errorf("expected error combining --format and --output")
+	}
+	listFormat = ""
+
+	// JSON
+	out.Reset()
+	if err := writeEntries(&out, entries, listStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []listEntry
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[1].ETag != `"abc"` || !decoded[1].Mtime.Equal(mtime) {
+		t.Errorf("unexpected JSON output: %s (%v)", out.String(), err)
+	}
+
+	// NDJSON
+	out.Reset()
+	output = outputNDJSON
+	if err := writeEntries(&out, entries, listStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(out.Bytes(), []byte("\n")); n != 2 {
+		t.Errorf("expected 2 lines of NDJSON, got %d", n)
+	}
+
+	// CSV
+	out.Reset()
+	output = outputCSV
+	if err := writeEntries(&out, entries, listStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil || len(rows) != 3 || rows[1][0] != "sub 01" || rows[1][4] != "true" || rows[2][2] != "1024" {
+		t.Errorf("unexpected CSV output: %v (%v)", rows, err)
+	}
+
+	// text
+	out.Reset()
+	output = outputText
+	if err := writeEntries(&out, entries, listStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "sub 01/\ndata.nii\n" {
+		t.Errorf("unexpected text output: %q", out.String())
+	}
+}
+
+func TestListEntries(t *testing.T) {
+
+	root := t.TempDir()
+	for _, d := range []string{"b", "b/c", ".hidden"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for f, size := range map[string]int{"a.txt": 5000, "b/x.dat": 10, "b/c/y.dat": 20, ".hidden/z": 1, ".profile": 1} {
+		if err := os.WriteFile(filepath.Join(root, f), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func() {
+		listRecursive, listAll, sortBySize, sortReverse, humanSizes = false, false, false, false, false
+	}()
+
+	names := func(entries []listEntry) string {
+		var b strings.Builder
+		for _, e := range entries {
+			b.WriteString(e.display + " ")
+		}
+		return b.String()
+	}
+	list := func() []listEntry {
+		entries, err := listEntries(context.Background(), root, treeWalker{list: listLocal, joinSrc: filepath.Join}, filepath.Join)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortEntries(entries)
+		return entries
+	}
+
+	if n := names(list()); n != "a.txt b " {
+		t.Errorf("unexpected listing: %s", n)
+	}
+
+	listAll = true
+	if n := names(list()); n != ".hidden .profile a.txt b " {
+		t.Errorf("unexpected listing with hidden entries: %s", n)
+	}
+
+	listAll, listRecursive = false, true
+	if n := names(list()); n != filepath.FromSlash("a.txt b b/c b/x.dat b/c/y.dat ") {
+		t.Errorf("unexpected recursive listing: %s", n)
+	}
+
+	listRecursive, sortBySize = false, true
+	entries := list()
+	if n := names(entries); n != "a.txt b " {
+		t.Errorf("unexpected listing by size: %s", n)
+	}
+	sortReverse = true
+	sortEntries(entries)
+	if n := names(entries); n != "b a.txt " {
+		t.Errorf("unexpected listing by reverse size: %s", n)
+	}
+
+	// the footer counts the entries with the total size of the files
+	humanSizes = true
+	var out bytes.Buffer
+	if err := writeEntries(&out, entries, listStyle{color: true, footer: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != colorDir+"b/"+colorReset+"\na.txt\n1 directories, 1 files, 4.9K in total\n" {
+		t.Errorf("unexpected text output: %q", out.String())
+	}
+
+	// the error of a sub-directory not listed is returned with the entries listed
+	listRecursive = true
+	w := treeWalker{
+		list: func(dir string) ([]fs.FileInfo, error) {
+			if filepath.Base(dir) == "c" {
+				return nil, os.ErrPermission
+			}
+			return listLocal(dir)
+		},
+		joinSrc: filepath.Join,
+	}
+	entries, err := listEntries(context.Background(), root, w, filepath.Join)
+	if !errors.Is(err, os.ErrPermission) || len(entries) != 4 {
+		t.Errorf("unexpected listing with an error: %s (%v)", names(entries), err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	defer func() { humanSizes = false }()
+	humanSizes = true
+	for n, s := range map[int64]string{0: "0", 1023: "1023", 1536: "1.5K", 250 * 1024 * 1024: "250M", 3 << 40: "3.0T"} {
+		if f := formatSize(n); f != s {
+			t.Errorf("%d: expected %s, got %s", n, s, f)
+		}
+	}
+}
+
+func TestListCommands(t *testing.T) {
+
+	defer func() {
+		listRecursive, listAll, sortBySize, sortReverse, humanSizes = false, false, false, false, false
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the flags are registered by cobra when the command is run, e.g. with a clashing shorthand
+	for _, c := range []struct {
+		cmd  *cobra.Command
+		args []string
+	}{
+		{lsCmd(), []string{"--help"}},
+		{llsCmd(), []string{"--help"}},
+		{llsCmd(), []string{"-R", "--human-readable", dir}},
+	} {
+		c.cmd.SetArgs(c.args)
+		c.cmd.SetOut(io.Discard)
+		if err := c.cmd.Execute(); err != nil {
+			t.Errorf("%s %v: %s", c.cmd.Name(), c.args, err)
+		}
+	}
+}
@@ -0,0 +1,584 @@
+package repocli
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// lockRecord is a WebDAV lock held by repocli, kept across runs in the locks file.
+type lockRecord struct {
+	URL   string `json:"url"`
+	Path  string `json:"path"`
+	Token string `json:"token"`
+	Scope string `json:"scope"`
+	Depth string `json:"depth"`
+	Owner string `json:"owner,omitempty"`
+	// Expires is the time at which the server releases the lock, zero for an infinite timeout.
+	Expires time.Time `json:"expires"`
+}
+
+// expired checks whether the lock is released by the server.
+func (r lockRecord) expired() bool {
+	return !r.Expires.IsZero() && time.Now().After(r.Expires)
+}
+
+// heldLocks are the locks held by repocli, loaded from the locks file at the first use.  The locks
+// file is kept apart from the state database, as it is read by every command sending a write
+// request, which should not wait for another repocli process holding the database.
+var heldLocks struct {
+	mutex  sync.Mutex
+	loaded bool
+	locks  []lockRecord
+}
+
+// getLocksPath returns the path of the locks file, which is located next to the configuration
+// file `configFile` like the state database.
+func getLocksPath() string {
+	p, _ := filepath.Abs(configFile)
+	return strings.TrimSuffix(p, filepath.Ext(p)) + ".locks"
+}
+
+// loadLocks loads the locks file if not yet loaded, leaving out the expired locks.  The caller must
+// hold `heldLocks.mutex`.
+func loadLocks() {
+	if heldLocks.loaded {
+		return
+	}
+	heldLocks.loaded = true
+
+	data, err := os.ReadFile(getLocksPath())
+	if err != nil {
+		return
+	}
+	var locks []lockRecord
+	if err := json.Unmarshal(data, &locks); err != nil {
+		log.Warnf("ignoring invalid locks file %s: %s", getLocksPath(), err)
+		return
+	}
+	for _, l := range locks {
+		if !l.expired() {
+			heldLocks.locks = append(heldLocks.locks, l)
+		}
+	}
+}
+
+// saveLocks writes the held locks into the locks file.  The caller must hold `heldLocks.mutex`.
+func saveLocks() error {
+	data, err := json.MarshalIndent(heldLocks.locks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := getLocksPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, getLocksPath())
+}
+
+// putLock adds or replaces the held lock `r` on its path.
+func putLock(r lockRecord) error {
+	heldLocks.mutex.Lock()
+	defer heldLocks.mutex.Unlock()
+	loadLocks()
+	locks := []lockRecord{r}
+	for _, l := range heldLocks.locks {
+		if l.URL != r.URL || l.Path != r.Path {
+			locks = append(locks, l)
+		}
+	}
+	heldLocks.locks = locks
+	return saveLocks()
+}
+
+// dropLock removes the held lock with the `token`.
+func dropLock(token string) error {
+	heldLocks.mutex.Lock()
+	defer heldLocks.mutex.Unlock()
+	loadLocks()
+	locks := make([]lockRecord, 0, len(heldLocks.locks))
+	for _, l := range heldLocks.locks {
+		if l.Token != token {
+			locks = append(locks, l)
+		}
+	}
+	heldLocks.locks = locks
+	return saveLocks()
+}
+
+// getHeldLock returns the lock held on the repository path `p` exactly.
+func getHeldLock(p string) (lockRecord, bool) {
+	heldLocks.mutex.Lock()
+	defer heldLocks.mutex.Unlock()
+	loadLocks()
+	for _, l := range heldLocks.locks {
+		if l.URL == davBaseURL && l.Path == p && !l.expired() {
+			return l, true
+		}
+	}
+	return lockRecord{}, false
+}
+
+// locksCovering returns the held locks that apply to the repository path `p`: the locks on `p`,
+// on its parent directory, whose members are protected, and the infinite-depth locks on its
+// ancestors.
+func locksCovering(p string) []lockRecord {
+	heldLocks.mutex.Lock()
+	defer heldLocks.mutex.Unlock()
+	loadLocks()
+	locks := make([]lockRecord, 0)
+	for _, l := range heldLocks.locks {
+		if l.URL != davBaseURL || l.expired() {
+			continue
+		}
+		if l.Path == p || l.Path == path.Dir(p) || (l.Depth == "infinity" && isAncestor(l.Path, p)) {
+			locks = append(locks, l)
+		}
+	}
+	return locks
+}
+
+// isAncestor checks whether the repository path `dir` is an ancestor of `p`.
+func isAncestor(dir, p string) bool {
+	return dir == "/" || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// lockedMethods are the methods of the write requests to which the tokens of the held locks are
+// submitted.
+var lockedMethods = map[string]bool{
+	"PUT":       true,
+	"DELETE":    true,
+	"MOVE":      true,
+	"COPY":      true,
+	"MKCOL":     true,
+	"PROPPATCH": true,
+}
+
+// lockTransport submits the tokens of the held locks in the `If` header of the write requests on
+// the locked resources, including the `Destination` of a MOVE or COPY.  A condition already in the
+// `If` header, e.g. the ETag of the destination, is a single list to which the tokens are added, as
+// the server evaluates separate lists as alternatives.
+type lockTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the `http.RoundTripper` interface.
+func (t *lockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !lockedMethods[req.Method] {
+		return t.next.RoundTrip(req)
+	}
+
+	prefix := davPathPrefix()
+	paths := []string{req.URL.Path}
+	if d := req.Header.Get("Destination"); d != "" {
+		paths = append(paths, d)
+	}
+
+	tokens := make(map[string]bool)
+	conds := make([]string, 0)
+	lists := make([]string, 0)
+	for _, href := range paths {
+		p, err := hrefPath(href, prefix)
+		if err != nil {
+			continue
+		}
+		for _, l := range locksCovering(p) {
+			if !tokens[l.Token] {
+				tokens[l.Token] = true
+				conds = append(conds, "<"+l.Token+">")
+				lists = append(lists, fmt.Sprintf("<%s> (<%s>)", dav.PathEscape(dav.Join(davBaseURL, l.Path)), l.Token))
+			}
+		}
+	}
+	if len(lists) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	h := strings.Join(lists, " ")
+	if c := req.Header.Get("If"); c != "" {
+		// e.g. `<dst> (["etag"])` becomes `<dst> (<token> ["etag"])`, which holds only if both do.
+		i := strings.LastIndex(c, "(")
+		h = c[:i+1] + strings.Join(conds, " ") + " " + c[i+1:]
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("If", h)
+	return t.next.RoundTrip(req)
+}
+
+// activeLock is an active lock on a resource, as reported by the server.
+type activeLock struct {
+	Root    string
+	Token   string
+	Scope   string
+	Depth   string
+	Owner   string
+	Timeout time.Duration
+}
+
+// String describes the lock for the users, e.g. in the error of a write request on a locked resource.
+func (l activeLock) String() string {
+	owner := "an unknown owner"
+	if l.Owner != "" {
+		owner = strconv.Quote(l.Owner)
+	}
+	expiry := "without timeout"
+	if l.Timeout > 0 {
+		expiry = "expiring in " + l.Timeout.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s (%s lock on %s, %s)", owner, l.Scope, l.Root, expiry)
+}
+
+// davActiveLock is the `activelock` element of the `lockdiscovery` property.
+type davActiveLock struct {
+	Exclusive *struct{} `xml:"DAV: lockscope>exclusive"`
+	Shared    *struct{} `xml:"DAV: lockscope>shared"`
+	Depth     string    `xml:"DAV: depth"`
+	Owner     struct {
+		Href string `xml:"DAV: href"`
+		Text string `xml:",chardata"`
+	} `xml:"DAV: owner"`
+	Timeout string `xml:"DAV: timeout"`
+	Token   string `xml:"DAV: locktoken>href"`
+	Root    string `xml:"DAV: lockroot>href"`
+}
+
+// lock returns the active lock of the `activelock` element, on the resource `p` if the server does
+// not tell the root of the lock.
+func (a davActiveLock) lock(p string) activeLock {
+	l := activeLock{
+		Root:  p,
+		Token: strings.TrimSpace(a.Token),
+		Scope: "exclusive",
+		Depth: strings.ToLower(strings.TrimSpace(a.Depth)),
+		Owner: strings.TrimSpace(a.Owner.Href),
+	}
+	if a.Shared != nil {
+		l.Scope = "shared"
+	}
+	if l.Owner == "" {
+		l.Owner = strings.TrimSpace(a.Owner.Text)
+	}
+	if r, err := hrefPath(strings.TrimSpace(a.Root), davPathPrefix()); err == nil && a.Root != "" {
+		l.Root = r
+	}
+	if s, ok := strings.CutPrefix(strings.TrimSpace(a.Timeout), "Second-"); ok {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			l.Timeout = time.Duration(n) * time.Second
+		}
+	}
+	return l
+}
+
+// lockDiscoveryBody is the body of the PROPFIND request for the active locks.
+const lockDiscoveryBody = `<d:propfind xmlns:d='DAV:'>
+	<d:prop>
+		<d:lockdiscovery/>
+	</d:prop>
+</d:propfind>`
+
+// getActiveLocks returns the active locks on the repository path `p`, and on its entries if `depth`
+// is "1".  A lock applying to several resources is returned once.
+func getActiveLocks(ctx context.Context, p, depth string) ([]activeLock, error) {
+
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml;charset=UTF-8")
+	header.Set("Accept", "application/xml,text/xml")
+
+	resp, err := davRequest(ctx, "PROPFIND", p, strings.NewReader(lockDiscoveryBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: %s", p, resp.Status)
+	}
+
+	var ms struct {
+		Responses []struct {
+			Href  string `xml:"DAV: href"`
+			Props []struct {
+				Status string          `xml:"DAV: status"`
+				Locks  []davActiveLock `xml:"DAV: prop>lockdiscovery>activelock"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	prefix := davPathPrefix()
+	seen := make(map[string]bool)
+	locks := make([]activeLock, 0)
+	for _, r := range ms.Responses {
+		rp, err := hrefPath(r.Href, prefix)
+		if err != nil {
+			continue
+		}
+		for _, props := range r.Props {
+			if !strings.Contains(props.Status, "200") {
+				continue
+			}
+			for _, a := range props.Locks {
+				l := a.lock(rp)
+				if !seen[l.Token] {
+					seen[l.Token] = true
+					locks = append(locks, l)
+				}
+			}
+		}
+	}
+	return locks, nil
+}
+
+// explainLocked adds the owner of the lock to the error `err` of a `423 Locked` response on one of
+// the repository `paths`.  Other errors are returned as they are.
+func explainLocked(ctx context.Context, err error, paths ...string) error {
+	var se dav.StatusError
+	if !errors.As(err, &se) || se.Status != http.StatusLocked {
+		return err
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		// the path does not exist yet if it is being created.
+		for _, q := range []string{p, path.Dir(p)} {
+			if locks, lerr := getActiveLocks(ctx, q, "0"); lerr == nil && len(locks) > 0 {
+				return fmt.Errorf("%w: locked by %s", err, locks[0])
+			}
+		}
+	}
+	return err
+}
+
+// lockBody is the body of the LOCK request, with the lock scope and the owner.
+const lockBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:lockinfo xmlns:d="DAV:">
+	<d:lockscope><d:%s/></d:lockscope>
+	<d:locktype><d:write/></d:locktype>
+	<d:owner>%s</d:owner>
+</d:lockinfo>`
+
+// lockRepo locks the repository path `p` with the `scope` for the `timeout`, or refreshes the lock
+// if it is already held.  A directory is locked with its whole tree.
+func lockRepo(ctx context.Context, p, scope, owner string, timeout time.Duration) (lockRecord, error) {
+
+	header := http.Header{}
+	header.Set("Timeout", "Infinite")
+	if timeout > 0 {
+		header.Set("Timeout", fmt.Sprintf("Second-%d", int64(timeout.Seconds())))
+	}
+	header.Set("Content-Type", "application/xml;charset=UTF-8")
+
+	var body io.Reader
+	rec, held := getHeldLock(p)
+	if held {
+		// a refresh has no body, and submits the token of the lock.
+		header.Set("If", fmt.Sprintf("(<%s>)", rec.Token))
+	} else {
+		rec = lockRecord{URL: davBaseURL, Path: p, Scope: scope, Depth: "0", Owner: owner}
+		if f, err := cli.Stat(p); err == nil && f.IsDir() {
+			rec.Depth = "infinity"
+		}
+		header.Set("Depth", rec.Depth)
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(owner))
+		body = strings.NewReader(fmt.Sprintf(lockBody, scope, b.String()))
+	}
+
+	resp, err := davRequest(ctx, "LOCK", p, body, header)
+	if err != nil {
+		return rec, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return rec, explainLocked(ctx, &os.PathError{Op: "LOCK", Path: p, Err: dav.StatusError{Status: resp.StatusCode}}, p)
+	}
+
+	if !held {
+		rec.Token = strings.Trim(resp.Header.Get("Lock-Token"), "<> ")
+		if rec.Token == "" {
+			return rec, fmt.Errorf("LOCK %s: no lock token in the response", p)
+		}
+	}
+
+	// the timeout granted by the server may differ from the requested one.
+	rec.Expires = time.Time{}
+	if timeout > 0 {
+		rec.Expires = time.Now().Add(timeout)
+	}
+	var prop struct {
+		Locks []davActiveLock `xml:"DAV: lockdiscovery>activelock"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&prop); err == nil {
+		for _, a := range prop.Locks {
+			if l := a.lock(p); l.Token == rec.Token {
+				rec.Expires = time.Time{}
+				if l.Timeout > 0 {
+					rec.Expires = time.Now().Add(l.Timeout)
+				}
+			}
+		}
+	}
+
+	return rec, putLock(rec)
+}
+
+// unlockRepo releases the lock with the `token` on the repository path `p`.  The held lock is
+// forgotten also if the server no longer knows it, e.g. when it is expired.
+func unlockRepo(ctx context.Context, p, token string) error {
+
+	header := http.Header{}
+	header.Set("Lock-Token", "<"+token+">")
+
+	resp, err := davRequest(ctx, "UNLOCK", p, nil, header)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return dropLock(token)
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		log.Warnf("lock on %s is no longer active: %s", p, resp.Status)
+		return dropLock(token)
+	}
+	return &os.PathError{Op: "UNLOCK", Path: p, Err: dav.StatusError{Status: resp.StatusCode}}
+}
+
+// options of the lock commands
+var lockTimeout time.Duration
+var lockShared bool
+var lockOwner string
+var lockToken string
+
+// command to lock a file or a directory in the repository.
+func lockCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "lock <repo_file|repo_dir>",
+		Short: "lock file or directory in the repository",
+		Long: `
+The "lock" subcommand is for locking a file or a directory in the repository with a WebDAV lock, so that others cannot write into it until it is unlocked or the lock times out.
+
+The mandatory argument is used to specify the file or directory in the repository to be locked.  A directory is locked with all its files and sub-directories.
+
+The lock is kept by repocli, and its token is sent with the following "put", "mput", "mv", "cp", "rm" and "mkdir" commands writing into the locked file or directory.  Locking a path again refreshes the lock with a new timeout.  The lock is released with the "unlock" subcommand.
+		`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p := getCleanRepoPath(args[0])
+			scope := "exclusive"
+			if lockShared {
+				scope = "shared"
+			}
+			owner := lockOwner
+			if owner == "" {
+				owner, _, _ = getCredential()
+			}
+			rec, err := lockRepo(cmd.Context(), p, scope, owner, lockTimeout)
+			if err != nil {
+				return err
+			}
+			expiry := "without timeout"
+			if !rec.Expires.IsZero() {
+				expiry = "until " + rec.Expires.Format(time.RFC3339)
+			}
+			log.Infof("%s locked %s: %s", p, expiry, rec.Token)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVarP(&lockTimeout, "timeout", "", 10*time.Minute, "`duration` after which the server releases the lock, or 0 for no timeout")
+	cmd.Flags().BoolVarP(&lockShared, "shared", "", false, "take a shared lock instead of an exclusive lock")
+	cmd.Flags().StringVarP(&lockOwner, "owner", "", "", "`owner` of the lock shown to others (default the username of the repository account)")
+	return cmd
+}
+
+// command to release a lock on a file or a directory in the repository.
+func unlockCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "unlock <repo_file|repo_dir>",
+		Short: "release the lock on file or directory in the repository",
+		Long: `
+The "unlock" subcommand is for releasing the lock taken by the "lock" subcommand on a file or a directory in the repository.
+
+The mandatory argument is used to specify the locked file or directory.  The "--token" flag releases a lock with the given token, e.g. a lock taken on another host.
+		`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p := getCleanRepoPath(args[0])
+			token := lockToken
+			if token == "" {
+				rec, ok := getHeldLock(p)
+				if !ok {
+					return fmt.Errorf("no lock held on %s", p)
+				}
+				token = rec.Token
+			}
+			return unlockRepo(cmd.Context(), p, token)
+		},
+	}
+
+	cmd.Flags().StringVarP(&lockToken, "token", "", "", "`token` of the lock to release")
+	return cmd
+}
+
+// command to list the active locks on a file or a directory in the repository.
+func locksCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "locks [<repo_file|repo_dir>]",
+		Short: "list the locks on file or directory in the repository",
+		Long: `
+The "locks" subcommand lists the active locks on a file or a directory in the repository, and on the entries of the directory, as reported by the server.  The locks held by repocli are marked with "*".
+
+The optional argument is used to specify the file or directory in the repository.  If no argument is provided, the current directory is used.
+		`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p := cwd
+			if len(args) == 1 {
+				p = getCleanRepoPath(args[0])
+			}
+			locks, err := getActiveLocks(cmd.Context(), p, "1")
+			if err != nil {
+				return err
+			}
+			for _, l := range locks {
+				mark := " "
+				if rec, ok := getHeldLock(l.Root); ok && rec.Token == l.Token {
+					mark = "*"
+				}
+				timeout := "infinite"
+				if l.Timeout > 0 {
+					timeout = l.Timeout.Round(time.Second).String()
+				}
+				fmt.Printf("%s %-9s %-8s %10s %-16s %s\n", mark, l.Scope, l.Depth, timeout, l.Owner, l.Root)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
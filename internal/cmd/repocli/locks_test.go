@@ -0,0 +1,83 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocks(t *testing.T) {
+
+	const token = "opaquelocktoken:0a1b2c"
+	activeLock := `<d:lockdiscovery><d:activelock>
+<d:locktype><d:write/></d:locktype><d:lockscope><d:exclusive/></d:lockscope>
+<d:depth>infinity</d:depth><d:owner>alice</d:owner><d:timeout>Second-300</d:timeout>
+<d:locktoken><d:href>` + token + `</d:href></d:locktoken><d:lockroot><d:href>/dav/data/</d:href></d:lockroot>
+</d:activelock></d:lockdiscovery>`
+
+	var ifHeader, lockBody string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "LOCK":
+			b, _ := io.ReadAll(r.Body)
+			lockBody = string(b)
+			w.Header().Set("Lock-Token", "<"+token+">")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:prop xmlns:d="DAV:">`+activeLock+`</d:prop>`)
+		case r.Method == "UNLOCK" && r.Header.Get("Lock-Token") == "<"+token+">":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "PROPFIND":
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype>%s</d:prop>
+<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, r.URL.Path, activeLock)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/dav/data/"):
+			ifHeader = r.Header.Get("If")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "PUT":
+			w.WriteHeader(http.StatusLocked)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	rec, err := lockRepo(context.Background(), "/data", "exclusive", "alice", 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Token != token || rec.Depth != "infinity" || !strings.Contains(lockBody, "<d:owner>alice</d:owner>") {
+		t.Errorf("unexpected lock %+v with request %s", rec, lockBody)
+	}
+	// the timeout granted by the server overrides the requested one
+	if d := time.Until(rec.Expires); d < 290*time.Second || d > 300*time.Second {
+		t.Errorf("unexpected expiry in %s", d)
+	}
+
+	// the held locks are reloaded from the locks file
+	heldLocks.loaded, heldLocks.locks = false, nil
+	if _, ok := getHeldLock("/data"); !ok {
+		t.Fatalf("lock on /data not held")
+	}
+
+	if err := cli.Write("/data/sub/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ifHeader, "/dav/data> (<"+token+">)") {
+		t.Errorf("lock token not submitted: If: %s", ifHeader)
+	}
+
+	err = explainLocked(context.Background(), cli.Write("/other/b.txt", []byte("b"), 0644), "/other/b.txt")
+	if err == nil || !strings.Contains(err.Error(), `locked by "alice"`) || errorClass(err) != "locked" {
+		t.Errorf("unexpected error of a locked file: %v", err)
+	}
+
+	if err := unlockRepo(context.Background(), "/data", token); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getHeldLock("/data"); ok {
+		t.Errorf("lock on /data still held after unlock")
+	}
+}
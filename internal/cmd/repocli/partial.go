@@ -0,0 +1,55 @@
+package repocli
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// partialSuffix is the filename suffix of the temporary file to which the data is
+// written during the transfer.  The temporary file is renamed to the final name
+// only when the transfer is completed successfully.
+const partialSuffix = ".partial"
+
+// getPartialPathLocal returns the path of the temporary local file for downloading
+// to the local file `p`.
+func getPartialPathLocal(p string) string {
+	return p + partialSuffix
+}
+
+// getPartialPathRepo returns the path of the hidden temporary repository file for uploading
+// to the repository file `p`, so that the partial upload is not visible to other users.  The
+// temporary file left by an interrupted upload is replaced when the file is uploaded again.
+func getPartialPathRepo(p string) string {
+	return path.Join(path.Dir(p), "."+path.Base(p)+partialSuffix)
+}
+
+// isPartialRepo checks whether the repository file with `name` is a temporary file of an
+// upload in progress (or of an interrupted upload).
+func isPartialRepo(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, partialSuffix)
+}
+
+// cleanPartialLocal removes the temporary files left by interrupted downloads of the `files` into
+// the local directory `dir`.  It is called with the listing of the directory before its files are
+// downloaded, so that the temporary files do not belong to the downloads in progress.  Only the
+// temporary files named after the files being downloaded are removed, so that other local files
+// with the suffix are left alone.
+func cleanPartialLocal(dir string, files []fs.FileInfo) {
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		p := getPartialPathLocal(filepath.Join(dir, f.Name()))
+		if info, err := os.Lstat(p); err == nil && info.Mode().IsRegular() {
+			log.Debugf("remove partial download: %s", p)
+			if err := os.Remove(p); err != nil {
+				log.Warnf("cannot remove partial download %s: %s", p, err)
+			}
+		}
+	}
+}
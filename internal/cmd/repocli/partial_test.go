@@ -0,0 +1,41 @@
+package repocli
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanPartialLocal(t *testing.T) {
+
+	dir := t.TempDir()
+	for name, mtime := range map[string]time.Time{
+		"a.txt.partial":   time.Now().Add(-time.Hour), // download of a.txt interrupted an hour ago
+		"b.txt.partial":   time.Now(),                 // download of b.txt interrupted just now
+		"notes.partial":   time.Now(),                 // file of the user
+		"c.txt.partial.1": time.Now(),
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []fs.FileInfo{testFileInfo{name: "a.txt"}, testFileInfo{name: "b.txt"}, testFileInfo{name: "c.txt"}, testFileInfo{name: "notes", isDir: true}}
+	cleanPartialLocal(dir, files)
+
+	entries, _ := os.ReadDir(dir)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if n := strings.Join(names, " "); n != "c.txt.partial.1 notes.partial" {
+		t.Errorf("unexpected files left: %s", n)
+	}
+}
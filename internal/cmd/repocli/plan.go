@@ -0,0 +1,243 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// planAction is an action planned in the dry-run mode.
+type planAction string
+
+const (
+	planPut    planAction = "put"
+	planGet    planAction = "get"
+	planCopy   planAction = "copy"
+	planMove   planAction = "move"
+	planRemove planAction = "remove"
+	planMkdir  planAction = "mkdir"
+	planBackup planAction = "backup"
+	planAsk    planAction = "ask"
+	planSkip   planAction = "skip"
+)
+
+// planActions is a list of planned actions in the order of the summary.
+var planActions = []planAction{planPut, planGet, planCopy, planMove, planRemove, planMkdir, planBackup, planAsk, planSkip}
+
+// probeSize is the number of bytes transferred for probing the throughput.
+const probeSize = 4 * 1024 * 1024
+
+var dryRun bool
+
+// plan collects the actions of the current command in the dry-run mode.
+var plan *transferPlan
+
+// transferPlan keeps counters of the planned actions, and the first planned transfer
+// for probing the throughput.
+type transferPlan struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	counts map[planAction]int
+	sizes  map[planAction]int64
+	// the first planned file transfer
+	probeAction planAction
+	probeSrc    string
+}
+
+// addDryRunFlag adds the `--dry-run` flag to the command `cmd`.
+func addDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "show planned actions with totals and estimated time, without making changes")
+}
+
+// initPlan initiates a new `plan` for the current command if it is in the dry-run mode.
+func initPlan() {
+	if !dryRun {
+		plan = nil
+		return
+	}
+	plan = &transferPlan{
+		out:    os.Stdout,
+		counts: make(map[planAction]int),
+		sizes:  make(map[planAction]int64),
+	}
+}
+
+// add prints the planned action on `src` and `dst` with the data `size`, and updates the counters.
+// The `dst` can be empty for actions on a single path, e.g. `planRemove` or `planMkdir`.
+func (p *transferPlan) add(action planAction, src, dst string, size int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.counts[action]++
+	p.sizes[action] += size
+
+	if p.probeAction == "" && (action == planPut || action == planGet) {
+		p.probeAction, p.probeSrc = action, src
+	}
+
+	if dst == "" {
+		fmt.Fprintf(p.out, "%-6s %12d %s\n", action, size, src)
+	} else {
+		fmt.Fprintf(p.out, "%-6s %12d %s -> %s\n", action, size, src, dst)
+	}
+}
+
+// summary prints the totals of the planned actions, and the estimated time for
+// completing the actions with `nworkers` concurrent workers.
+func (p *transferPlan) summary(nworkers int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	nfiles, nbytes := 0, int64(0)
+	totals := make([]string, 0, len(planActions))
+	for _, action := range planActions {
+		c, ok := p.counts[action]
+		if !ok {
+			continue
+		}
+		totals = append(totals, fmt.Sprintf("%d %s (%s)", c, action, humanizeBytes(p.sizes[action])))
+		if action != planSkip && action != planAsk {
+			nfiles += c
+			nbytes += p.sizes[action]
+		}
+	}
+
+	if len(totals) == 0 {
+		fmt.Fprintf(p.out, "planned: nothing to do\n")
+		return
+	}
+	fmt.Fprintf(p.out, "planned: %s\n", strings.Join(totals, ", "))
+
+	eta, detail, err := p.estimate(nfiles, nbytes, nworkers)
+	if err != nil {
+		fmt.Fprintf(p.out, "estimated time: unknown (%s)\n", err)
+		return
+	}
+	fmt.Fprintf(p.out, "estimated time: %s (%s, %d workers)\n", eta.Round(time.Second), detail, nworkers)
+}
+
+// estimate returns the time needed for `nfiles` operations transferring `nbytes` data with `nworkers`
+// concurrent workers.  The estimate is based on the request latency and, if there are files to transfer,
+// the throughput probed with the first planned transfer.
+//
+// The download throughput is probed by reading the first `probeSize` bytes of a file.  The upload
+// throughput is not probed, as it takes writing into the repository; the bandwidth limit is used
+// instead if it is set.
+func (p *transferPlan) estimate(nfiles int, nbytes int64, nworkers int) (time.Duration, string, error) {
+
+	if nworkers < 1 {
+		nworkers = 1
+	}
+
+	// probe the request latency with a PROPFIND on the root of the current working directory
+	t0 := time.Now()
+	if _, err := cli.Stat(cwd); err != nil {
+		return 0, "", fmt.Errorf("cannot probe latency: %s", err)
+	}
+	latency := time.Since(t0)
+
+	eta := time.Duration(nfiles) * latency / time.Duration(nworkers)
+	detail := fmt.Sprintf("latency %s", latency.Round(time.Millisecond))
+
+	if nbytes == 0 || p.probeAction == "" {
+		return eta, detail, nil
+	}
+
+	if p.probeAction == planPut {
+		rate := bwlimit.rate(time.Now())
+		if rate == 0 {
+			return eta, detail + ", upload throughput unknown", nil
+		}
+		eta += time.Duration(float64(nbytes) / float64(rate) * float64(time.Second))
+		return eta, fmt.Sprintf("%s, bandwidth limit %s/s", detail, humanizeBytes(rate)), nil
+	}
+
+	t0 = time.Now()
+	n, err := probeDownload(p.probeSrc)
+	if err != nil {
+		return 0, "", fmt.Errorf("cannot probe throughput: %s", err)
+	}
+
+	rate := float64(n) / time.Since(t0).Seconds()
+	eta += time.Duration(float64(nbytes) / (rate * float64(nworkers)) * float64(time.Second))
+	detail = fmt.Sprintf("%s, throughput %s/s per worker", detail, humanizeBytes(int64(rate)))
+
+	return eta, detail, nil
+}
+
+// probeDownload reads up to `probeSize` bytes of the repository file `p`.  It returns the number of bytes read.
+func probeDownload(p string) (int64, error) {
+	log.Debugf("probing download throughput with %s", p)
+	reader, err := cli.ReadStreamRange(p, 0, probeSize)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return io.Copy(io.Discard, reader)
+}
+
+// humanizeBytes returns the size of `b` bytes in a human-readable form, e.g. "1.5 GiB".
+func humanizeBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// mkdirRepo creates the repository directory `p`, including the missing parents if `parents` is true.
+// In the dry-run mode, it only plans the creation if the directory does not exist.
+func mkdirRepo(ctx context.Context, p string, perm fs.FileMode, parents bool) error {
+	if plan != nil {
+		if _, err := cli.Stat(p); err != nil {
+			plan.add(planMkdir, p, "", 0)
+		}
+		return nil
+	}
+	return withRetry(ctx, "mkdir "+p, func() error {
+		if parents {
+			return cli.MkdirAll(p, perm)
+		}
+		return cli.Mkdir(p, perm)
+	})
+}
+
+// mkdirLocal creates the local directory `p` with all its missing parents.  In the dry-run mode,
+// it only plans the creation if the directory does not exist.
+func mkdirLocal(p string, perm fs.FileMode) error {
+	if plan != nil {
+		if _, err := os.Stat(p); err != nil {
+			plan.add(planMkdir, p, "", 0)
+		}
+		return nil
+	}
+	return os.MkdirAll(p, perm)
+}
+
+// removeRepo removes the repository file or directory `f`.  In the dry-run mode, it only plans the removal.
+func removeRepo(ctx context.Context, f pathFileInfo) error {
+	if plan != nil {
+		var size int64
+		if f.info != nil {
+			size = f.info.Size()
+		}
+		plan.add(planRemove, f.path, "", size)
+		return nil
+	}
+	return withRetry(ctx, "remove "+f.path, func() error {
+		return cli.Remove(f.path)
+	})
+}
@@ -0,0 +1,49 @@
+package repocli
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateUpload(t *testing.T) {
+
+	// the server only answers the PROPFIND probing the latency
+	var methods []string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Method != "PROPFIND" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, r.URL.Path)
+	})
+
+	defer func() { bwlimit = bwSchedule{} }()
+	p := &transferPlan{probeAction: planPut, probeSrc: "/tmp/a.dat"}
+
+	// nothing is written into the repository for a dry run
+	_, detail, err := p.estimate(1, 10<<20, 4)
+	if err != nil || !strings.Contains(detail, "upload throughput unknown") {
+		t.Errorf("unexpected estimate without bandwidth limit: %s, %v", detail, err)
+	}
+	for _, m := range methods {
+		if m != "PROPFIND" {
+			t.Errorf("unexpected %s request for the estimate", m)
+		}
+	}
+
+	// the bandwidth limit gives the upload throughput
+	if err := bwlimit.Set("1M"); err != nil {
+		t.Fatal(err)
+	}
+	eta, detail, err := p.estimate(1, 10<<20, 4)
+	if err != nil || eta < 10*time.Second || !strings.Contains(detail, "bandwidth limit 1.0 MiB/s") {
+		t.Errorf("unexpected estimate with bandwidth limit: %s, %s, %v", eta, detail, err)
+	}
+}
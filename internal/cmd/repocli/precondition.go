@@ -0,0 +1,66 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// errChangedRemotely is the error of an upload of which the destination is changed or created by
+// someone else since it was checked, i.e. the server responds `412 Precondition Failed`.
+var errChangedRemotely = errors.New("changed on the repository since it was checked")
+
+// precondition is the state of a repository file observed before it is written, which is expected
+// to be unchanged when the file is written.
+type precondition struct {
+	// absent is set if the file did not exist.
+	absent bool
+	// etag is the ETag of the existing file, empty if the state is not known.
+	etag string
+}
+
+// moveHeader returns the headers of a MOVE to the repository path `p`, checking that `p` is still in the
+// state `pre`: the MOVE fails if `p` exists while it should be absent, or if `p` has another ETag.  It
+// is the equivalent of `If-None-Match: *` and `If-Match` for the destination of the MOVE, to which
+// these headers do not apply.
+func (pre precondition) moveHeader(p string) http.Header {
+	header := http.Header{}
+	switch {
+	case pre.absent:
+		header.Set("Overwrite", "F")
+	case pre.etag != "":
+		header.Set("Overwrite", "T")
+		header.Set("If", fmt.Sprintf("<%s> ([%s])", dav.PathEscape(dav.Join(davBaseURL, p)), pre.etag))
+	default:
+		header.Set("Overwrite", "T")
+	}
+	return header
+}
+
+// moveRepoIf moves the repository file `src` to `dst` if `dst` is still in the state `pre`.  It returns
+// `errChangedRemotely` if the state of `dst` is changed.
+func moveRepoIf(ctx context.Context, src, dst string, pre precondition) error {
+
+	header := pre.moveHeader(dst)
+	header.Set("Destination", dav.PathEscape(dav.Join(davBaseURL, dst)))
+
+	resp, err := davRequest(ctx, "MOVE", src, nil, header)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%s %w: %w", dst, errChangedRemotely, &os.PathError{Op: "MOVE", Path: dst, Err: dav.StatusError{Status: resp.StatusCode}})
+	}
+	return &os.PathError{Op: "MOVE", Path: src, Err: dav.StatusError{Status: resp.StatusCode}}
+}
@@ -0,0 +1,84 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMoveRepoIf(t *testing.T) {
+
+	// the destination exists with the ETag "v2"
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "MOVE" || !strings.HasSuffix(r.Header.Get("Destination"), "/dav/data/a.txt") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.Header.Get("Overwrite") == "F":
+			w.WriteHeader(http.StatusPreconditionFailed)
+		case r.Header.Get("If") != "" && !strings.Contains(r.Header.Get("If"), `(["v2"])`):
+			w.WriteHeader(http.StatusPreconditionFailed)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	for _, c := range []struct {
+		pre     precondition
+		changed bool
+	}{
+		{precondition{}, false},
+		{precondition{etag: `"v2"`}, false},
+		{precondition{etag: `"v1"`}, true},
+		{precondition{absent: true}, true},
+	} {
+		err := moveRepoIf(context.Background(), "/data/.a.txt.part", "/data/a.txt", c.pre)
+		if c.changed != errors.Is(err, errChangedRemotely) {
+			t.Errorf("%+v: unexpected error %v", c.pre, err)
+		}
+		if c.changed && errorClass(err) != "conflict" {
+			t.Errorf("%+v: unexpected error class %s", c.pre, errorClass(err))
+		}
+		if c.changed && (opResult{err: err}).status() != "conflict" {
+			t.Errorf("%+v: unexpected status %s", c.pre, (opResult{err: err}).status())
+		}
+	}
+}
+
+func TestMoveRepoIfLocked(t *testing.T) {
+
+	// the destination exists with the ETag "v2" in the directory /data locked by repocli; the MOVE
+	// proceeds only if both the token and the ETag are in the same list of the If header.
+	const token = "opaquelocktoken:0a1b2c"
+	var ifHeader string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		ifHeader = r.Header.Get("If")
+		switch {
+		case r.Method != "MOVE":
+			w.WriteHeader(http.StatusBadRequest)
+		case !strings.Contains(ifHeader, "<"+token+">"):
+			w.WriteHeader(http.StatusLocked)
+		case !strings.Contains(ifHeader, `(<`+token+`> ["v2"])`):
+			w.WriteHeader(http.StatusPreconditionFailed)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	if err := putLock(lockRecord{URL: davBaseURL, Path: "/data", Token: token, Scope: "exclusive", Depth: "infinity"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveRepoIf(context.Background(), "/data/.a.txt.part", "/data/a.txt", precondition{etag: `"v2"`}); err != nil {
+		t.Errorf("unexpected error with the matching ETag: %v (If: %s)", err, ifHeader)
+	}
+	err := moveRepoIf(context.Background(), "/data/.a.txt.part", "/data/a.txt", precondition{etag: `"v1"`})
+	if !errors.Is(err, errChangedRemotely) {
+		t.Errorf("expected 412 with the ETag mis-match, got %v (If: %s)", err, ifHeader)
+	}
+	if strings.Count(ifHeader, "(") != 1 {
+		t.Errorf("token and ETag not in a single list: If: %s", ifHeader)
+	}
+}
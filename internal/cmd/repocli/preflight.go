@@ -0,0 +1,160 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// forceTransfer starts a transfer without checking the local free space or the repository quota,
+// and with a warning instead of an error if it does not fit in the dry-run mode.
+var forceTransfer bool
+
+// addPreflightFlag adds the `--force` flag to the transfer command `cmd`.
+func addPreflightFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&forceTransfer, "force", "", false, "start the transfer without checking that it fits in the local free space or the repository quota")
+}
+
+// plannedBytes returns the number of bytes the transfer of the `inputs` adds at the destination,
+// walking through the source directories with `w`.  The existing files at the destination, listed
+// with `dstList`, are replaced by the transfer, so that their sizes are subtracted.  The `split`
+// splits a destination path into the directory and the file name.
+func plannedBytes(ctx context.Context, w treeWalker, inputs []opInput, dstList func(dir string) ([]fs.FileInfo, error), split func(p string) (string, string)) int64 {
+
+	var mutex sync.Mutex
+	var need int64
+
+	// sizes of the existing files in the destination directory `dir`
+	dstSizes := func(dir string) map[string]int64 {
+		sizes := make(map[string]int64)
+		if files, err := dstList(dir); err == nil {
+			for _, f := range files {
+				if !f.IsDir() {
+					sizes[f.Name()] = f.Size()
+				}
+			}
+		}
+		return sizes
+	}
+
+	w.onList = func(dir opInput, files []fs.FileInfo) {
+		existing := dstSizes(dir.dst.path)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, f := range files {
+			if !f.IsDir() {
+				need += f.Size() - existing[f.Name()]
+			}
+		}
+	}
+
+	// the files are pushed by the walker for the operations, which are not needed for counting.
+	ichan := make(chan opInput, opQueueSize)
+	go func() {
+		for range ichan {
+		}
+	}()
+	defer close(ichan)
+
+	for _, in := range inputs {
+		if in.src.info.IsDir() {
+			if err := w.walk(ctx, in, ichan); err != nil {
+				log.Debugf("estimated the transfer size partially: %s", err)
+			}
+			continue
+		}
+		dir, name := split(in.dst.path)
+		need += in.src.info.Size() - dstSizes(dir)[name]
+	}
+
+	if need < 0 {
+		return 0
+	}
+	return need
+}
+
+// checkCapacity checks that the transfer of `need` bytes fits in the `avail` bytes `where`.  If it
+// does not fit, it only warns if `forceTransfer` is set or in the dry-run mode.
+func checkCapacity(need, avail int64, where string) error {
+	if need <= avail {
+		log.Debugf("transfer of %d bytes fits in %d bytes available %s", need, avail, where)
+		return nil
+	}
+	msg := fmt.Sprintf("transfer of %d bytes does not fit in %d bytes available %s", need, avail, where)
+	if forceTransfer || plan != nil {
+		log.Warnf("%s", msg)
+		return nil
+	}
+	return fmt.Errorf("%s, use --force to start it anyway", msg)
+}
+
+// preflightGet checks that the download of the `inputs` fits in the free space of the local
+// filesystem of the directory `dir`.  The check is left out if the free space is unknown, or if
+// `forceTransfer` is set, as the walk through the repository directories would be done twice.
+func preflightGet(ctx context.Context, inputs []opInput, dir string) error {
+
+	if forceTransfer && plan == nil {
+		return nil
+	}
+
+	// the destination directory may not exist yet.
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	avail, err := diskFree(dir)
+	if err != nil {
+		log.Debugf("free space of %s not available: %s", dir, err)
+		return nil
+	}
+
+	w := treeWalker{
+		list:    listRepo,
+		tree:    listRepoTree,
+		skip:    isPartialRepoFile,
+		joinSrc: path.Join,
+		joinDst: filepath.Join,
+	}
+	need := plannedBytes(ctx, w, inputs, listLocal, filepath.Split)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return checkCapacity(need, avail, "on the local filesystem of "+dir)
+}
+
+// preflightPut checks that the upload of the `inputs` fits in the quota of the repository directory
+// `dir` (RFC 4331).  The check is left out if the server does not provide the quota, or if
+// `forceTransfer` is set.
+func preflightPut(ctx context.Context, inputs []opInput, dir string) error {
+
+	if forceTransfer && plan == nil {
+		return nil
+	}
+
+	q, err := getQuota(ctx, dir)
+	if err != nil || q.available == nil {
+		log.Debugf("quota of %s not available: %v", dir, err)
+		return nil
+	}
+
+	w := treeWalker{
+		list:    listLocal,
+		joinSrc: filepath.Join,
+		joinDst: path.Join,
+	}
+	need := plannedBytes(ctx, w, inputs, listRepo, path.Split)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return checkCapacity(need, *q.available, "in the repository quota of "+dir)
+}
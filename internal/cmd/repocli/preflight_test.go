@@ -0,0 +1,76 @@
+package repocli
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlannedBytes(t *testing.T) {
+
+	src, dst := t.TempDir(), t.TempDir()
+	for p, size := range map[string]int{
+		"a.txt":     100,
+		"sub/b.txt": 200,
+		"sub/c.txt": 300,
+	} {
+		os.MkdirAll(filepath.Join(src, filepath.Dir(p)), 0755)
+		os.WriteFile(filepath.Join(src, p), make([]byte, size), 0644)
+	}
+	// an existing file at the destination is replaced by the transfer
+	os.MkdirAll(filepath.Join(dst, "sub"), 0755)
+	os.WriteFile(filepath.Join(dst, "sub", "b.txt"), make([]byte, 150), 0644)
+
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := treeWalker{list: listLocal, joinSrc: filepath.Join, joinDst: filepath.Join}
+	in := opInput{src: pathFileInfo{path: src, info: info}, dst: pathFileInfo{path: dst}}
+
+	if need := plannedBytes(context.Background(), w, []opInput{in}, listLocal, filepath.Split); need != 450 {
+		t.Errorf("planned bytes: got %d, expected 450", need)
+	}
+
+	finfo, _ := os.Stat(filepath.Join(src, "sub", "c.txt"))
+	file := opInput{src: pathFileInfo{path: filepath.Join(src, "sub", "c.txt"), info: finfo}, dst: pathFileInfo{path: filepath.Join(dst, "c.txt")}}
+	if need := plannedBytes(context.Background(), w, []opInput{file}, listLocal, filepath.Split); need != 300 {
+		t.Errorf("planned bytes of a single file: got %d, expected 300", need)
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+
+	if err := checkCapacity(100, 100, "here"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := checkCapacity(101, 100, "here"); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected an error suggesting --force, got %v", err)
+	}
+
+	forceTransfer = true
+	defer func() { forceTransfer = false }()
+	if err := checkCapacity(101, 100, "here"); err != nil {
+		t.Errorf("unexpected error with --force: %s", err)
+	}
+}
+
+func TestPreflightForce(t *testing.T) {
+
+	// the repository directory is not walked through with --force
+	nreq := 0
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		nreq++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	forceTransfer = true
+	defer func() { forceTransfer = false }()
+	in := opInput{src: pathFileInfo{path: "/data", info: testFileInfo{name: "data", isDir: true}}, dst: pathFileInfo{path: t.TempDir()}}
+	if err := preflightGet(context.Background(), []opInput{in}, in.dst.path); err != nil || nreq != 0 {
+		t.Errorf("unexpected preflight with --force: %d requests, %v", nreq, err)
+	}
+}
@@ -0,0 +1,181 @@
+package repocli
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// privilegeSet is a set of the WebDAV privileges (RFC 3744) of the current user on a resource.
+type privilegeSet uint8
+
+const (
+	// privRead is the privilege of reading the content and the properties.
+	privRead privilegeSet = 1 << iota
+	// privWrite is the privilege of modifying the content, i.e. `DAV:write-content`.
+	privWrite
+	// privBind is the privilege of adding entries into a collection, i.e. creating files and directories.
+	privBind
+	// privUnbind is the privilege of removing entries from a collection, i.e. removing or moving files
+	// and directories away.
+	privUnbind
+)
+
+// privilegeLetters are the letters of the privileges in the string of a `privilegeSet`.
+var privilegeLetters = []struct {
+	p      privilegeSet
+	letter byte
+}{{privRead, 'r'}, {privWrite, 'w'}, {privBind, 'b'}, {privUnbind, 'u'}}
+
+// privilegeNames maps the RFC 3744 privileges, including the aggregates, to the privilege sets.
+var privilegeNames = map[string]privilegeSet{
+	"all":           privRead | privWrite | privBind | privUnbind,
+	"read":          privRead,
+	"write":         privWrite | privBind | privUnbind,
+	"write-content": privWrite,
+	"bind":          privBind,
+	"unbind":        privUnbind,
+}
+
+// String returns the privileges as the letters `rwbu` for read, write, bind and unbind, with a `-`
+// for a missing privilege.
+func (s privilegeSet) String() string {
+	b := []byte("----")
+	for i, l := range privilegeLetters {
+		if s&l.p != 0 {
+			b[i] = l.letter
+		}
+	}
+	return string(b)
+}
+
+// privilegeUnknown is the string of the privileges that are not provided by the server.
+const privilegeUnknown = "????"
+
+// privilegeBody is the body of the PROPFIND request for the privileges of the current user.
+const privilegeBody = `<d:propfind xmlns:d='DAV:'>
+	<d:prop>
+		<d:current-user-privilege-set/>
+	</d:prop>
+</d:propfind>`
+
+// davPrivilegeResponse is the `response` element of a PROPFIND response with the privileges.
+type davPrivilegeResponse struct {
+	Href  string `xml:"DAV: href"`
+	Props []struct {
+		Status     string `xml:"DAV: status"`
+		Privileges []struct {
+			Items []struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:"DAV: prop>current-user-privilege-set>privilege"`
+	} `xml:"DAV: propstat"`
+}
+
+// davMultiStatus is the body of a multi-status response.
+type davMultiStatus struct {
+	Responses []davPrivilegeResponse `xml:"DAV: response"`
+}
+
+// getPrivileges returns the privileges of the current user on the repository path `p`, and on the
+// entries of `p` if it is a directory and `depth` is "1".  The resources for which the server does
+// not provide the privileges are left out.
+func getPrivileges(ctx context.Context, p string, depth string) (map[string]privilegeSet, error) {
+
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml;charset=UTF-8")
+	header.Set("Accept", "application/xml,text/xml")
+
+	resp, err := davRequest(ctx, "PROPFIND", p, strings.NewReader(privilegeBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: %s", p, resp.Status)
+	}
+
+	var ms davMultiStatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	prefix := davPathPrefix()
+	privs := make(map[string]privilegeSet)
+	for _, r := range ms.Responses {
+		rp, err := hrefPath(r.Href, prefix)
+		if err != nil {
+			continue
+		}
+		for _, props := range r.Props {
+			// the property is in a `404 Not Found` propstat if the server does not support RFC 3744.
+			if !strings.Contains(props.Status, "200") {
+				continue
+			}
+			var s privilegeSet
+			for _, priv := range props.Privileges {
+				for _, item := range priv.Items {
+					if item.XMLName.Space == "DAV:" {
+						s |= privilegeNames[item.XMLName.Local]
+					}
+				}
+			}
+			privs[rp] = s
+		}
+	}
+	return privs, nil
+}
+
+// setPrivileges sets the privileges of the repository `entries`.  The privileges are requested once
+// for every parent directory of the entries, and set to `privilegeUnknown` if they are not provided.
+func setPrivileges(ctx context.Context, entries []listEntry) {
+
+	privs := make(map[string]privilegeSet)
+	listed := make(map[string]bool)
+	for i := range entries {
+		dir := path.Dir(entries[i].Path)
+		if !listed[dir] {
+			listed[dir] = true
+			if ps, err := getPrivileges(ctx, dir, "1"); err == nil {
+				for p, s := range ps {
+					privs[p] = s
+				}
+			}
+		}
+		entries[i].Privileges = privilegeUnknown
+		if s, ok := privs[path.Clean(entries[i].Path)]; ok {
+			entries[i].Privileges = s.String()
+		}
+	}
+}
+
+// requirePrivilege checks that the current user has the privileges `need` on the repository path `p`,
+// for the `action` in the error message.  It fails only if the server tells the privileges are
+// missing; an unknown privilege, e.g. for a server without RFC 3744 support, passes the check.
+func requirePrivilege(ctx context.Context, p string, need privilegeSet, action string) error {
+	privs, err := getPrivileges(ctx, p, "0")
+	if err != nil {
+		return nil
+	}
+	s, ok := privs[path.Clean("/"+p)]
+	if !ok || s&need == need {
+		return nil
+	}
+	return fmt.Errorf("permission denied: %s requires the %s privilege on %s, which has %s", action, need.names(), p, s)
+}
+
+// names returns the RFC 3744 names of the privileges.
+func (s privilegeSet) names() string {
+	names := make([]string, 0)
+	for _, n := range []string{"read", "write-content", "bind", "unbind"} {
+		if s&privilegeNames[n] != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,61 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPrivileges(t *testing.T) {
+
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dav/data/</d:href><d:propstat><d:prop><d:current-user-privilege-set>
+<d:privilege><d:read/></d:privilege><d:privilege><d:bind/></d:privilege>
+</d:current-user-privilege-set></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/data/a.txt</d:href><d:propstat><d:prop><d:current-user-privilege-set>
+<d:privilege><d:all/></d:privilege>
+</d:current-user-privilege-set></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/data/b.txt</d:href><d:propstat><d:prop><d:current-user-privilege-set/>
+</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat></d:response>
+</d:multistatus>`)
+	})
+
+	privs, err := getPrivileges(context.Background(), "/data", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := privs["/data"].String(); s != "r-b-" {
+		t.Errorf("privileges of /data: got %s, expected r-b-", s)
+	}
+	if s := privs["/data/a.txt"].String(); s != "rwbu" {
+		t.Errorf("privileges of /data/a.txt: got %s, expected rwbu", s)
+	}
+	if _, ok := privs["/data/b.txt"]; ok {
+		t.Errorf("privileges of /data/b.txt: expected unknown")
+	}
+
+	entries := []listEntry{{Path: "/data/a.txt"}, {Path: "/data/b.txt"}}
+	setPrivileges(context.Background(), entries)
+	if entries[0].Privileges != "rwbu" || entries[1].Privileges != privilegeUnknown {
+		t.Errorf("unexpected privileges of entries: %s, %s", entries[0].Privileges, entries[1].Privileges)
+	}
+
+	err = requirePrivilege(context.Background(), "/data", privUnbind, "removing /data/a.txt")
+	if err == nil || !strings.Contains(err.Error(), "unbind") {
+		t.Errorf("expected the unbind privilege to be missing, got %v", err)
+	}
+	if err := requirePrivilege(context.Background(), "/data", privBind, "uploading"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := requirePrivilege(context.Background(), "/data/b.txt", privUnbind, "removing"); err != nil {
+		t.Errorf("unknown privileges should pass the check: %s", err)
+	}
+}
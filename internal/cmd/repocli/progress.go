@@ -0,0 +1,270 @@
+package repocli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// display is the multi-line progress display of the current recursive transfer, or `nil` if the
+// progress is shown on a single line.
+var display *multiProgress
+
+// maxMutex serializes the updates of the total of the progress bars, which grows while the
+// directories are listed concurrently.
+var maxMutex sync.Mutex
+
+// addProgressMax adds `n` to the total of the progress bar `pbar`.
+func addProgressMax(pbar *pb.ProgressBar, n int64) {
+	maxMutex.Lock()
+	defer maxMutex.Unlock()
+	pbar.ChangeMax64(pbar.GetMax64() + n)
+}
+
+// multiProgress is a progress display with the aggregate bar on the first line, followed by
+// the bar of the file being transferred by every active worker.  The bars are rendered by the
+// progress bar library into the lines of the display via `lineWriter`, and the display is
+// redrawn in place with ANSI escape sequences.
+type multiProgress struct {
+	mutex sync.Mutex
+	out   io.Writer
+	// lines are the rendered bars, the first one is the aggregate bar.  The line of an idle worker is empty.
+	lines []string
+	// ndrawn is the number of lines drawn at the last redraw.
+	ndrawn   int
+	lastDraw time.Time
+}
+
+// newMultiProgress returns a multi-line progress display on the stderr, or `nil` if the stderr
+// is not a terminal.
+func newMultiProgress() *multiProgress {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return &multiProgress{out: os.Stderr, lines: make([]string, 1)}
+}
+
+// lineWriter is the writer of a progress bar rendered into the line `n` of the display.
+type lineWriter struct {
+	m *multiProgress
+	n int
+}
+
+// Write implements the `io.Writer` interface.  The progress bar library writes either a
+// rendering of the bar, or blanks to clear the line.
+func (w lineWriter) Write(b []byte) (int, error) {
+	s := strings.TrimSpace(strings.ReplaceAll(string(b), "\r", ""))
+	if s == "" {
+		return len(b), nil
+	}
+
+	w.m.mutex.Lock()
+	defer w.m.mutex.Unlock()
+	for len(w.m.lines) <= w.n {
+		w.m.lines = append(w.m.lines, "")
+	}
+	w.m.lines[w.n] = s
+
+	// the aggregate bar is always drawn, as it is throttled by the library already and its
+	// final state must be shown.
+	if w.n == 0 || time.Since(w.m.lastDraw) > 100*time.Millisecond {
+		w.m.draw()
+	}
+	return len(b), nil
+}
+
+// release clears the line `n` of the display once the worker is idle.
+func (m *multiProgress) release(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if n < len(m.lines) {
+		m.lines[n] = ""
+	}
+}
+
+// draw redraws the display over the lines drawn previously.  It must be called with the mutex held.
+func (m *multiProgress) draw() {
+	var b strings.Builder
+	if m.ndrawn > 1 {
+		fmt.Fprintf(&b, "\033[%dA", m.ndrawn-1)
+	}
+	b.WriteString("\r\033[2K")
+	b.WriteString(m.lines[0])
+	m.ndrawn = 1
+	for _, l := range m.lines[1:] {
+		if l == "" {
+			continue
+		}
+		b.WriteString("\n\033[2K")
+		b.WriteString(l)
+		m.ndrawn++
+	}
+	// clear the lines of the workers that have become idle
+	b.WriteString("\033[J")
+	io.WriteString(m.out, b.String())
+	m.lastDraw = time.Now()
+}
+
+// transferProgress reports the bytes of a single file transfer to the bar of the file, and to the
+// aggregate bar `total` of a recursive transfer if it is not `nil`.
+//
+// The aggregate bar is only moved forward, so that the bytes transferred again in a retry
+// attempt are not counted twice.
+type transferProgress struct {
+	// newBar makes the bar of the file for every transfer attempt.
+	newBar func(desc string, size int64) *pb.ProgressBar
+	total  *pb.ProgressBar
+	bar    *pb.ProgressBar
+	pos    int64
+	// reported is the number of bytes reported to the aggregate bar.
+	reported int64
+	// done is called when the transfer is completed, e.g. to release the line of the worker.
+	done func()
+	// src is the path of the file in the `bytes` progress events, which are emitted if it is set.
+	src       string
+	lastEvent time.Time
+	// attempts is the number of transfer attempts.
+	attempts int
+	// hash is the checksum of the data transferred in the current attempt, if it is set.  It is
+	// dropped if the upload is rewound to another position than the start.
+	hash hash.Hash
+}
+
+// newFileProgress returns the progress of the transfer of a single file, shown on the stderr if `show` is
+// set and the progress is not written as JSON events.
+func newFileProgress(show bool) *transferProgress {
+	return &transferProgress{
+		newBar: func(desc string, size int64) *pb.ProgressBar {
+			if show && events == nil {
+				return pb.DefaultBytes(size, desc)
+			}
+			return pb.DefaultBytesSilent(size, desc)
+		},
+	}
+}
+
+// newWorkerProgress returns the progress of a file transfer by the worker `n` of a recursive transfer
+// with the aggregate bar `total`.  The bar of the file is shown on the line of the worker if the
+// display `m` is not `nil`.
+func newWorkerProgress(m *multiProgress, n int, total *pb.ProgressBar) *transferProgress {
+	p := &transferProgress{
+		total: total,
+		newBar: func(desc string, size int64) *pb.ProgressBar {
+			return pb.DefaultBytesSilent(size, desc)
+		},
+	}
+	if m != nil {
+		p.newBar = func(desc string, size int64) *pb.ProgressBar {
+			bar := pb.NewOptions64(
+				size,
+				pb.OptionSetDescription(desc),
+				pb.OptionSetWriter(lineWriter{m: m, n: n + 1}),
+				pb.OptionShowBytes(true),
+				pb.OptionSetWidth(10),
+				pb.OptionThrottle(65*time.Millisecond),
+				pb.OptionShowCount(),
+				pb.OptionSpinnerType(14),
+				pb.OptionFullWidth(),
+			)
+			bar.RenderBlank()
+			return bar
+		}
+		p.done = func() { m.release(n + 1) }
+	}
+	return p
+}
+
+// start starts a transfer attempt of the file with `size` bytes.
+func (p *transferProgress) start(desc string, size int64) {
+	p.bar = p.newBar(desc, size)
+	p.pos = 0
+	p.attempts++
+	if p.hash != nil {
+		p.hash.Reset()
+	}
+}
+
+// checksum returns the MD5 checksum of the data transferred in the last attempt, or an empty
+// string if it is not computed.
+func (p *transferProgress) checksum() string {
+	if p.hash == nil || p.attempts == 0 {
+		return ""
+	}
+	return hex.EncodeToString(p.hash.Sum(nil))
+}
+
+// set sets the number of bytes transferred in the current attempt to `pos`.
+func (p *transferProgress) set(pos int64) {
+	p.bar.Set64(pos)
+	p.pos = pos
+	if p.total != nil && pos > p.reported {
+		p.total.Add64(pos - p.reported)
+		p.reported = pos
+	}
+	if p.src != "" && time.Since(p.lastEvent) >= bytesEventInterval {
+		events.transferred(p.src, pos)
+		p.lastEvent = time.Now()
+	}
+}
+
+// Write implements the `io.Writer` interface, for counting the bytes written to the destination.
+func (p *transferProgress) Write(b []byte) (int, error) {
+	if p.hash != nil {
+		p.hash.Write(b)
+	}
+	p.set(p.pos + int64(len(b)))
+	return len(b), nil
+}
+
+// finish ends the transfer of the file with `size` bytes, and returns the bytes not yet reported
+// to the aggregate bar, e.g. of a skipped file.
+func (p *transferProgress) finish(size int64) int64 {
+	if p.done != nil {
+		p.done()
+	}
+	if size < p.reported {
+		return 0
+	}
+	return size - p.reported
+}
+
+// progressReader reports the bytes read from, and the position set on, the reader of an upload.
+// It remains seekable, so that the upload can be rewound by the WebDAV client without buffering.
+type progressReader struct {
+	io.ReadSeeker
+	p *transferProgress
+}
+
+// Read implements the `io.Reader` interface.
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(b)
+	if r.p.hash != nil {
+		r.p.hash.Write(b[:n])
+	}
+	r.p.set(r.p.pos + int64(n))
+	return n, err
+}
+
+// Seek implements the `io.Seeker` interface.
+func (r progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		if r.p.hash != nil {
+			if pos == 0 {
+				r.p.hash.Reset()
+			} else {
+				r.p.hash = nil
+			}
+		}
+		r.p.set(pos)
+	}
+	return pos, err
+}
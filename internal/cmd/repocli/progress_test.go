@@ -0,0 +1,89 @@
+package repocli
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/schollz/progressbar/v3"
+)
+
+func TestTransferProgress(t *testing.T) {
+
+	total := pb.DefaultBytesSilent(100)
+	tp := newWorkerProgress(nil, 0, total)
+
+	// the bytes read are reported while streaming, and a rewind is not counted twice
+	tp.start("file", 10)
+	r := progressReader{strings.NewReader("0123456789"), tp}
+	if _, err := io.CopyN(io.Discard, r, 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if tp.pos != 0 || tp.reported != 6 {
+		t.Errorf("unexpected progress after rewind: pos %d, reported %d", tp.pos, tp.reported)
+	}
+
+	tp.start("file", 10)
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if n := tp.finish(10); n != 0 || total.State().CurrentBytes != 10 {
+		t.Errorf("unexpected aggregate progress: remainder %d, total %.0f", n, total.State().CurrentBytes)
+	}
+
+	// the bytes of a skipped file are left to the caller
+	tp = newWorkerProgress(nil, 0, total)
+	if n := tp.finish(20); n != 20 {
+		t.Errorf("expected remainder 20 of skipped file, got %d", n)
+	}
+}
+
+func TestMultiProgress(t *testing.T) {
+
+	var out bytes.Buffer
+	m := &multiProgress{out: &out, lines: make([]string, 1)}
+
+	lineWriter{m: m}.Write([]byte("\rtotal 10%"))
+	lineWriter{m: m, n: 2}.Write([]byte("\rfile2 50%"))
+	lineWriter{m: m}.Write([]byte("\rtotal 20%"))
+
+	if !strings.HasSuffix(out.String(), "\r\033[2Ktotal 20%\n\033[2Kfile2 50%\033[J") {
+		t.Errorf("unexpected display: %q", out.String())
+	}
+
+	// the line of an idle worker is removed
+	m.release(2)
+	out.Reset()
+	lineWriter{m: m}.Write([]byte("\r  \r"))
+	lineWriter{m: m}.Write([]byte("\rtotal 30%"))
+	if out.String() != "\033[1A\r\033[2Ktotal 30%\033[J" {
+		t.Errorf("unexpected display: %q", out.String())
+	}
+}
+
+func TestAddProgressMax(t *testing.T) {
+
+	// the total grows from the concurrent listings of the directories
+	pbar := pb.DefaultSilent(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				addProgressMax(pbar, 10)
+			}
+		}()
+	}
+	wg.Wait()
+	addProgressMax(pbar, -1)
+
+	if n := pbar.GetMax64(); n != 8000 {
+		t.Errorf("expected the total 8000, got %d", n)
+	}
+}
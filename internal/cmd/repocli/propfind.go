@@ -0,0 +1,267 @@
+package repocli
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// fastListing enables listing a directory tree with a single PROPFIND request with `Depth: infinity`.
+var fastListing bool
+
+// errTreeUnsupported is returned by `listRepoTree` when the server does not support listing
+// a directory tree with infinite depth.
+var errTreeUnsupported = errors.New("infinite-depth listing not supported")
+
+// treeBatchSize is the maximum number of entries of a directory passed on in one batch.
+const treeBatchSize = 1000
+
+// infinityProbe keeps the outcome of probing the server for infinite-depth support, so that
+// the server is probed only once.
+var infinityProbe struct {
+	mutex     sync.Mutex
+	baseURL   string
+	supported bool
+}
+
+// propfindBody is the body of the PROPFIND request, with the same properties as `cli.ReadDir`.
+const propfindBody = `<d:propfind xmlns:d='DAV:'>
+	<d:prop>
+		<d:displayname/>
+		<d:resourcetype/>
+		<d:getcontentlength/>
+		<d:getcontenttype/>
+		<d:getetag/>
+		<d:getlastmodified/>
+	</d:prop>
+</d:propfind>`
+
+// davProps is the `propstat` element of a PROPFIND response.
+type davProps struct {
+	Status      string   `xml:"DAV: status"`
+	Name        string   `xml:"DAV: prop>displayname,omitempty"`
+	Type        xml.Name `xml:"DAV: prop>resourcetype>collection,omitempty"`
+	Size        string   `xml:"DAV: prop>getcontentlength,omitempty"`
+	ContentType string   `xml:"DAV: prop>getcontenttype,omitempty"`
+	ETag        string   `xml:"DAV: prop>getetag,omitempty"`
+	Modified    string   `xml:"DAV: prop>getlastmodified,omitempty"`
+}
+
+// davResponse is the `response` element of a PROPFIND response.
+type davResponse struct {
+	Href  string     `xml:"DAV: href"`
+	Props []davProps `xml:"DAV: propstat"`
+}
+
+// davFileInfo implements `fs.FileInfo` for an entry of a PROPFIND response.  Like the
+// files returned by `cli.ReadDir`, it also provides the `ETag` and the `ContentType`.
+type davFileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	isDir       bool
+	etag        string
+	contentType string
+}
+
+func (f *davFileInfo) Name() string        { return f.name }
+func (f *davFileInfo) Size() int64         { return f.size }
+func (f *davFileInfo) ModTime() time.Time  { return f.modTime }
+func (f *davFileInfo) IsDir() bool         { return f.isDir }
+func (f *davFileInfo) Sys() interface{}    { return nil }
+func (f *davFileInfo) ETag() string        { return f.etag }
+func (f *davFileInfo) ContentType() string { return f.contentType }
+
+// Mode returns the same file mode as the files returned by `cli.ReadDir`.
+func (f *davFileInfo) Mode() fs.FileMode {
+	if f.isDir {
+		return 0775 | os.ModeDir
+	}
+	return 0664
+}
+
+// listRepoTree lists the repository directory tree under `root` with a single PROPFIND request
+// with `Depth: infinity`.  The response is parsed while it is received, and once it is complete the
+// entries are passed on to `fn` in batches of entries in the same directory, parent directories first.
+//
+// It returns `errTreeUnsupported` without calling `fn` if the `fastListing` is not enabled, or the
+// server does not support infinite depth.  The outcome of the first attempt is kept, so that the
+// server is not asked again.
+func listRepoTree(ctx context.Context, root string, fn func(dir string, files []fs.FileInfo)) error {
+
+	if !fastListing {
+		return errTreeUnsupported
+	}
+
+	infinityProbe.mutex.Lock()
+	probed := infinityProbe.baseURL == davBaseURL
+	if probed && !infinityProbe.supported {
+		infinityProbe.mutex.Unlock()
+		return errTreeUnsupported
+	}
+	infinityProbe.mutex.Unlock()
+
+	header := http.Header{}
+	header.Set("Depth", "infinity")
+	header.Set("Content-Type", "application/xml;charset=UTF-8")
+	header.Set("Accept", "application/xml,text/xml")
+
+	resp, err := davRequest(ctx, "PROPFIND", root, strings.NewReader(propfindBody), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// servers refusing infinite depth respond with 403 (DAV:propfind-finite-depth), or with other
+	// errors if the `Depth` header is not understood.
+	if resp.StatusCode != http.StatusMultiStatus {
+		if !probed {
+			log.Debugf("PROPFIND with infinite depth refused: %s", resp.Status)
+			infinityProbe.mutex.Lock()
+			infinityProbe.baseURL, infinityProbe.supported = davBaseURL, false
+			infinityProbe.mutex.Unlock()
+			return errTreeUnsupported
+		}
+		return fmt.Errorf("PROPFIND %s: %s", root, resp.Status)
+	}
+
+	if !probed {
+		infinityProbe.mutex.Lock()
+		infinityProbe.baseURL, infinityProbe.supported = davBaseURL, true
+		infinityProbe.mutex.Unlock()
+	}
+
+	// the path prefix of the base URL, to be removed from the `href` of the entries
+	prefix := davPathPrefix()
+	root = path.Clean("/" + root)
+
+	// entries grouped by their directory, as the server is not required to return the entries of a
+	// directory together, nor after the entry of the directory itself.
+	entries := make(map[string][]fs.FileInfo)
+
+	decoder := xml.NewDecoder(resp.Body)
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Space != "DAV:" || se.Name.Local != "response" {
+			continue
+		}
+
+		var r davResponse
+		if err := decoder.DecodeElement(&r, &se); err != nil {
+			return err
+		}
+
+		p, f := parseDavResponse(r, prefix)
+		if f == nil || p == root {
+			continue
+		}
+
+		d := path.Dir(p)
+		entries[d] = append(entries[d], f)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	// a directory sorts before its sub-directories, so that the entry of a directory is passed on
+	// before its content.
+	dirs := make([]string, 0, len(entries))
+	for d := range entries {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		for files := entries[d]; len(files) > 0; {
+			n := len(files)
+			if n > treeBatchSize {
+				n = treeBatchSize
+			}
+			fn(d, files[:n])
+			files = files[n:]
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// parseDavResponse returns the repository path and the file info of the PROPFIND response `r`.
+// The path prefix of the base URL `prefix` is removed from the path.  The file info is nil if
+// the properties of the entry are not available.
+func parseDavResponse(r davResponse, prefix string) (string, fs.FileInfo) {
+
+	var props *davProps
+	for i := range r.Props {
+		if strings.Contains(r.Props[i].Status, "200") {
+			props = &r.Props[i]
+			break
+		}
+	}
+	if props == nil {
+		return "", nil
+	}
+
+	p, err := hrefPath(r.Href, prefix)
+	if err != nil {
+		return "", nil
+	}
+
+	f := &davFileInfo{
+		name:        path.Base(p),
+		isDir:       props.Type.Local == "collection",
+		etag:        props.ETag,
+		contentType: props.ContentType,
+	}
+	if t, err := http.ParseTime(props.Modified); err == nil {
+		f.modTime = t
+	}
+	if !f.isDir {
+		f.size, _ = strconv.ParseInt(props.Size, 10, 64)
+	}
+	return p, f
+}
+
+// davPathPrefix returns the path prefix of the base URL, which is in the `href` of the entries
+// of the PROPFIND responses.
+func davPathPrefix() string {
+	prefix := "/"
+	if u, err := url.Parse(davBaseURL); err == nil {
+		prefix = "/" + strings.Trim(u.Path, "/")
+	}
+	return prefix
+}
+
+// hrefPath returns the repository path of the `href` of a PROPFIND response entry, with the path
+// prefix of the base URL `prefix` removed.  The href is either an absolute URL or an absolute path.
+func hrefPath(href, prefix string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return path.Clean("/" + strings.TrimPrefix(u.Path, prefix)), nil
+}
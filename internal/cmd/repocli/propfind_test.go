@@ -0,0 +1,93 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// multistatus returns a PROPFIND response with entries of the given paths; paths ending
+// with "/" are collections.
+func multistatus(paths ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">`)
+	for _, p := range paths {
+		rtype := ""
+		if strings.HasSuffix(p, "/") {
+			rtype = "<d:collection/>"
+		}
+		fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop>
+<d:resourcetype>%s</d:resourcetype><d:getcontentlength>%d</d:getcontentlength>
+<d:getetag>"%s"</d:getetag><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified>
+</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, p, rtype, len(p), p)
+	}
+	b.WriteString(`</d:multistatus>`)
+	return b.String()
+}
+
+func TestListRepoTree(t *testing.T) {
+
+	infinity := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" || r.Header.Get("Depth") != "infinity" || !infinity {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		// the entries of a directory are not returned together, nor after the directory itself
+		fmt.Fprint(w, multistatus(
+			"/dav/data/",
+			"/dav/data/sub%20dir/b.txt",
+			"/dav/data/a.txt",
+			"/dav/data/sub%20dir/",
+			"/dav/data/sub%20dir/c.txt",
+		))
+	}))
+	defer srv.Close()
+
+	davBaseURL, fastListing = srv.URL+"/dav/", true
+	defer func() { davBaseURL, fastListing = "", false }()
+
+	got := map[string][]string{}
+	var dirs []string
+	err := listRepoTree(context.Background(), "/data", func(dir string, files []fs.FileInfo) {
+		dirs = append(dirs, dir)
+		for _, f := range files {
+			got[dir] = append(got[dir], f.Name())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(dirs, ",") != "/data,/data/sub dir" {
+		t.Errorf("expected one batch per directory, parent first, got %v", dirs)
+	}
+
+	expected := map[string]string{
+		"/data":         "a.txt,sub dir",
+		"/data/sub dir": "b.txt,c.txt",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for dir, names := range expected {
+		if strings.Join(got[dir], ",") != names {
+			t.Errorf("expected %s in %s, got %v", names, dir, got[dir])
+		}
+	}
+
+	// the server refusing infinite depth is remembered
+	infinity = false
+	davBaseURL = srv.URL + "/other/"
+	if err := listRepoTree(context.Background(), "/data", nil); err != errTreeUnsupported {
+		t.Errorf("expected %v, got %v", errTreeUnsupported, err)
+	}
+	infinity = true
+	if err := listRepoTree(context.Background(), "/data", nil); err != errTreeUnsupported {
+		t.Errorf("expected %v after probing, got %v", errTreeUnsupported, err)
+	}
+}
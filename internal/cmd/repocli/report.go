@@ -0,0 +1,246 @@
+package repocli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// reportFile is the path of the report of the current command.
+var reportFile string
+
+// addReportFlag adds the `--report` flag to the command `cmd`.
+func addReportFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&reportFile, "report", "", "", "write a report of every file and a summary of the operation to the JSON or CSV (by extension) `file`")
+}
+
+// opResult is the result of an operation on a single file, as performed by `doOp`.
+type opResult struct {
+	in       opInput
+	skipped  bool
+	err      error
+	bytes    int64
+	duration time.Duration
+	// attempts is the number of transfer attempts of a `Put` or `Get`, zero if the file is not transferred.
+	attempts int
+	checksum string
+	// written is the path written by a `Move` or `Copy`, which is another path than the destination
+	// if renamed by the conflict policy.
+	written string
+	// backup is the path to which the existing destination of a `Move` or `Copy` is renamed by the
+	// backup policy.
+	backup string
+}
+
+// status returns the status of the result in the reports.
+func (r opResult) status() string {
+	switch {
+	case errors.Is(r.err, errChangedRemotely):
+		return "conflict"
+	case r.err != nil:
+		return "failed"
+	case r.skipped:
+		return "skipped"
+	}
+	return "ok"
+}
+
+// reportRecord is the record of a single file in the report.
+type reportRecord struct {
+	Src        string  `json:"src"`
+	Dst        string  `json:"dst,omitempty"`
+	Size       int64   `json:"size"`
+	Duration   float64 `json:"duration"`
+	Throughput float64 `json:"throughput"`
+	Checksum   string  `json:"checksum,omitempty"`
+	Status     string  `json:"status"`
+	Retries    int     `json:"retries"`
+	Error      string  `json:"error,omitempty"`
+	ErrorClass string  `json:"error_class,omitempty"`
+}
+
+// csvHeader is the header of the file records in the CSV report.
+var csvHeader = []string{"src", "dst", "size", "duration", "throughput", "checksum", "status", "retries", "error", "error_class"}
+
+// reportSummary is the summary of the operation in the report.
+type reportSummary struct {
+	Op          string  `json:"op"`
+	Started     string  `json:"started"`
+	Finished    string  `json:"finished"`
+	Files       int     `json:"files"`
+	Succeeded   int     `json:"succeeded"`
+	Skipped     int     `json:"skipped"`
+	Failed      int     `json:"failed"`
+	Conflicts   int     `json:"conflicts"`
+	Retries     int     `json:"retries"`
+	Bytes       int64   `json:"bytes"`
+	WallTime    float64 `json:"wall_time"`
+	AverageRate float64 `json:"average_rate"`
+	Cancelled   bool    `json:"cancelled"`
+}
+
+// transferReport writes the report of an operation to a file, in JSON or in CSV.  The records of the
+// files are written as the files are processed, and the summary when the operation is finished.
+//
+// The JSON report is an object with the `files` records and the `summary`.  The CSV report has a row
+// per file, followed by an empty row and the summary as the rows of field name and value.
+type transferReport struct {
+	mutex   sync.Mutex
+	f       *os.File
+	csv     *csv.Writer
+	summary reportSummary
+	start   time.Time
+	nrec    int
+}
+
+// newTransferReport creates the report of the operation `op` in the file `p`.
+func newTransferReport(p string, op Op) (*transferReport, error) {
+	f, err := os.OpenFile(p, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &transferReport{
+		f:     f,
+		start: time.Now(),
+		summary: reportSummary{
+			Op:      opNames[op],
+			Started: time.Now().Format(time.RFC3339),
+		},
+	}
+
+	if strings.EqualFold(filepath.Ext(p), ".csv") {
+		r.csv = csv.NewWriter(f)
+		err = r.csv.Write(csvHeader)
+	} else {
+		_, err = io.WriteString(f, "{\"files\":[")
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// add adds the result `res` of the operation on a file to the report.
+func (r *transferReport) add(res opResult) error {
+	rec := reportRecord{
+		Src:      res.in.src.path,
+		Dst:      res.in.dst.path,
+		Duration: res.duration.Seconds(),
+		Checksum: res.checksum,
+		Status:   res.status(),
+	}
+	if res.in.src.info != nil && !res.in.src.info.IsDir() {
+		rec.Size = res.in.src.info.Size()
+	}
+	if res.attempts > 1 {
+		rec.Retries = res.attempts - 1
+	}
+	if res.bytes > 0 && res.duration > 0 {
+		rec.Throughput = float64(res.bytes) / res.duration.Seconds()
+	}
+	if res.err != nil {
+		rec.Error = res.err.Error()
+		rec.ErrorClass = errorClass(res.err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.summary.Files++
+	r.summary.Retries += rec.Retries
+	r.summary.Bytes += res.bytes
+	switch rec.Status {
+	case "failed":
+		r.summary.Failed++
+	case "conflict":
+		r.summary.Conflicts++
+	case "skipped":
+		r.summary.Skipped++
+	default:
+		r.summary.Succeeded++
+	}
+
+	if r.csv != nil {
+		return r.csv.Write([]string{
+			rec.Src,
+			rec.Dst,
+			strconv.FormatInt(rec.Size, 10),
+			strconv.FormatFloat(rec.Duration, 'f', 3, 64),
+			strconv.FormatFloat(rec.Throughput, 'f', 0, 64),
+			rec.Checksum,
+			rec.Status,
+			strconv.Itoa(rec.Retries),
+			rec.Error,
+			rec.ErrorClass,
+		})
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	sep := "\n"
+	if r.nrec > 0 {
+		sep = ",\n"
+	}
+	r.nrec++
+	_, err = io.WriteString(r.f, sep+string(data))
+	return err
+}
+
+// close writes the summary of the operation, possibly cancelled via `ctx`, and closes the report.
+func (r *transferReport) close(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	defer r.f.Close()
+
+	wall := time.Since(r.start)
+	r.summary.Finished = time.Now().Format(time.RFC3339)
+	r.summary.WallTime = wall.Seconds()
+	if wall > 0 {
+		r.summary.AverageRate = float64(r.summary.Bytes) / wall.Seconds()
+	}
+	r.summary.Cancelled = ctx.Err() != nil
+
+	if r.csv != nil {
+		s := r.summary
+		rows := [][]string{
+			{},
+			{"op", s.Op},
+			{"started", s.Started},
+			{"finished", s.Finished},
+			{"files", strconv.Itoa(s.Files)},
+			{"succeeded", strconv.Itoa(s.Succeeded)},
+			{"skipped", strconv.Itoa(s.Skipped)},
+			{"failed", strconv.Itoa(s.Failed)},
+			{"conflicts", strconv.Itoa(s.Conflicts)},
+			{"retries", strconv.Itoa(s.Retries)},
+			{"bytes", strconv.FormatInt(s.Bytes, 10)},
+			{"wall_time", strconv.FormatFloat(s.WallTime, 'f', 3, 64)},
+			{"average_rate", strconv.FormatFloat(s.AverageRate, 'f', 0, 64)},
+			{"cancelled", strconv.FormatBool(s.Cancelled)},
+		}
+		r.csv.WriteAll(rows)
+		return r.csv.Error()
+	}
+
+	data, err := json.Marshal(r.summary)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.f, "\n],\"summary\":%s}\n", data)
+	return err
+}
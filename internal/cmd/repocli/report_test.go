@@ -0,0 +1,122 @@
+package repocli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransferReport(t *testing.T) {
+
+	results := []opResult{
+		{in: opInput{src: pathFileInfo{path: "/a/f1"}, dst: pathFileInfo{path: "/b/f1"}}, bytes: 2048, duration: 2 * time.Second, attempts: 2, checksum: "d41d8cd98f00b204e9800998ecf8427e"},
+		{in: opInput{src: pathFileInfo{path: "/a/f2"}, dst: pathFileInfo{path: "/b/f2"}}, skipped: true},
+		{in: opInput{src: pathFileInfo{path: "/a/f3"}, dst: pathFileInfo{path: "/b/f3"}}, err: errors.New("failure"), attempts: 3},
+	}
+
+	write := func(p string) {
+		r, err := newTransferReport(p, Put)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, res := range results {
+			if err := r.add(res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// JSON report
+	p := filepath.Join(t.TempDir(), "report.json")
+	write(p)
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Files   []reportRecord `json:"files"`
+		Summary reportSummary  `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JSON report: %s\n%s", err, data)
+	}
+	if len(report.Files) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(report.Files))
+	}
+	if f := report.Files[0]; f.Status != "ok" || f.Retries != 1 || f.Throughput != 1024 {
+		t.Errorf("unexpected record: %+v", f)
+	}
+	if s := report.Summary; s.Succeeded != 1 || s.Skipped != 1 || s.Failed != 1 || s.Retries != 3 || s.Bytes != 2048 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	// CSV report
+	p = filepath.Join(t.TempDir(), "report.csv")
+	write(p)
+
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 4 || rows[0][0] != "src" || rows[3][6] != "failed" || rows[3][8] != "failure" {
+		t.Errorf("unexpected CSV records: %v", rows)
+	}
+	if last := rows[len(rows)-1]; last[0] != "cancelled" || last[1] != "false" {
+		t.Errorf("unexpected CSV summary: %v", last)
+	}
+}
+
+func TestRunSingleOpReport(t *testing.T) {
+
+	// the destination is absent, and the server copies the file itself
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PROPFIND":
+			w.WriteHeader(http.StatusNotFound)
+		case "COPY":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	defer func(p string) { reportFile = p }(reportFile)
+	reportFile = filepath.Join(t.TempDir(), "report.json")
+
+	in := opInput{src: pathFileInfo{path: "/data/a.txt", info: testFileInfo{name: "a.txt", size: 1}}, dst: pathFileInfo{path: "/data/b.txt"}}
+	if res := runSingleOp(context.Background(), Copy, in, false); res.err != nil || res.written != "/data/b.txt" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Files   []reportRecord `json:"files"`
+		Summary reportSummary  `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JSON report: %s\n%s", err, data)
+	}
+	if len(report.Files) != 1 || report.Files[0].Status != "ok" || report.Summary.Succeeded != 1 {
+		t.Errorf("unexpected report: %s", data)
+	}
+}
@@ -0,0 +1,34 @@
+package repocli
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// davRequest sends a WebDAV request with `method` on the repository path `p`, for the
+// requests that are not provided by the client `cli`.  The request is sent through the
+// same transport `davTransport` as the client, with the basic authentication of the
+// current credential.
+//
+// The caller is responsible for closing the body of the returned response.
+func davRequest(ctx context.Context, method, p string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, dav.PathEscape(dav.Join(davBaseURL, p)), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, vals := range header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+
+	if user, pass, _ := getCredential(); user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+
+	return (&http.Client{Transport: davTransport}).Do(req)
+}
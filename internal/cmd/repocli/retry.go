@@ -0,0 +1,170 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	dav "github.com/studio-b12/gowebdav"
+)
+
+const (
+	// defaultMaxRetry is the default number of retry attempts of a failed operation.
+	defaultMaxRetry = 2
+	// defaultRetryDelay is the default delay before the first retry attempt.
+	defaultRetryDelay = time.Second
+	// maxRetryDelay is the upper bound of the delay between retry attempts.
+	maxRetryDelay = time.Minute
+)
+
+// retryPolicy is the policy for retrying failed operations: up to `max` attempts with an exponential
+// backoff starting from `delay`.
+type retryPolicy struct {
+	max   int
+	delay time.Duration
+}
+
+// retries is the retry policy of the current command.
+var retries = retryPolicy{max: defaultMaxRetry, delay: defaultRetryDelay}
+
+// retryAfter is the time, in Unix nanoseconds, before which the server asked not to be contacted
+// again via the `Retry-After` header of a 429 or 503 response.
+var retryAfter atomic.Int64
+
+// retryableError marks an error as transient, e.g. an incomplete transfer, so that the operation is retried.
+type retryableError struct {
+	error
+}
+
+// Unwrap returns the underlying error.
+func (e retryableError) Unwrap() error {
+	return e.error
+}
+
+// addRetryFlags adds the flags of the retry policy to the command `cmd`.  The `shorthand` of the
+// `--retry` flag can be empty.
+func addRetryFlags(cmd *cobra.Command, shorthand string) {
+	// reset to default as the commands are re-created for every command line in the shell mode.
+	retries = retryPolicy{max: defaultMaxRetry, delay: defaultRetryDelay}
+	cmd.Flags().IntVarP(&retries.max, "retry", shorthand, defaultMaxRetry, "make `N` retry attempts on failures that are likely transient, e.g. network errors or 5xx responses")
+	cmd.Flags().DurationVarP(&retries.delay, "retry-delay", "", defaultRetryDelay, "initial delay before retrying, doubled after each attempt")
+}
+
+// withRetry runs `fn` and retries it on retryable errors according to the retry policy `retries`.
+// The `desc` describes the operation in the log messages.  It returns the error of the last attempt,
+// wrapping the error of `ctx` if it is cancelled while waiting for the next attempt.
+func withRetry(ctx context.Context, desc string, fn func() error) error {
+	for c := 0; ; c++ {
+		err := fn()
+		if err == nil || c >= retries.max || !isRetryable(err) {
+			return err
+		}
+		wait := backoff(c)
+		log.Debugf("%s: %s, retrying #%d in %s", desc, err, c+1, wait.Round(time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (%w)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the retry attempt following `c` failed retries.  The delay is doubled
+// after each attempt with a random jitter, and is extended to respect the `Retry-After` of the server.
+func backoff(c int) time.Duration {
+	d := retries.delay << c
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	// jitter between half and the full delay
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	if after := time.Until(time.Unix(0, retryAfter.Load())); after > d {
+		d = after
+	}
+	return d
+}
+
+// isRetryable classifies the error `err` as retryable, i.e. network timeouts, connections reset or
+// refused, incomplete transfers, and the responses 408, 429 and 5xx except 501 and 505; or as
+// permanent, e.g. 403 or 404.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var se dav.StatusError
+	if errors.As(err, &se) {
+		return isRetryableStatus(se.Status)
+	}
+
+	// other network errors, e.g. an invalid certificate or an unknown host, are permanent.
+	var re retryableError
+	var ne net.Error
+	switch {
+	case errors.As(err, &re), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	case errors.As(err, &ne):
+		return ne.Timeout()
+	}
+	return false
+}
+
+// isRetryableStatus checks whether a response with the HTTP `status` code is worth retrying.
+//
+// A 401 is retried as long as the credential can be renewed in the shell mode, as the request
+// may not be re-sent right away by `sessionTransport`, e.g. an upload.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized:
+		credential.mutex.Lock()
+		defer credential.mutex.Unlock()
+		return shellMode && !credential.rejected
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return status >= 500
+}
+
+// observeRetryAfter keeps the `Retry-After` of the response `resp` to the throttling responses 429 and 503.
+// The header is either a number of seconds or a HTTP date.
+func observeRetryAfter(resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return
+	}
+
+	var t time.Time
+	if s, err := strconv.Atoi(v); err == nil {
+		t = time.Now().Add(time.Duration(s) * time.Second)
+	} else if t, err = http.ParseTime(v); err != nil {
+		return
+	}
+
+	for {
+		cur := retryAfter.Load()
+		if t.UnixNano() <= cur || retryAfter.CompareAndSwap(cur, t.UnixNano()) {
+			return
+		}
+	}
+}
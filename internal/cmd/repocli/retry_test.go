@@ -0,0 +1,154 @@
+package repocli
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	dav "github.com/studio-b12/gowebdav"
+)
+
+func TestIsRetryable(t *testing.T) {
+
+	statusErr := func(status int) error {
+		return &os.PathError{Op: "PUT", Path: "/f", Err: dav.StatusError{Status: status}}
+	}
+
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{errors.New("cannot open local file"), false},
+		{statusErr(http.StatusForbidden), false},
+		{statusErr(http.StatusNotFound), false},
+		{statusErr(http.StatusNotImplemented), false},
+		{statusErr(http.StatusRequestTimeout), true},
+		{statusErr(http.StatusTooManyRequests), true},
+		{statusErr(http.StatusBadGateway), true},
+		{fmt.Errorf("cannot write: %w", statusErr(http.StatusServiceUnavailable)), true},
+		{&url.Error{Op: "Put", URL: "https://example.org/f", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{&url.Error{Op: "Put", URL: "https://example.org/f", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{&url.Error{Op: "Put", URL: "https://example.org/f", Err: &net.DNSError{Err: "i/o timeout", Name: "example.org", IsTimeout: true}}, true},
+		{&url.Error{Op: "Put", URL: "https://example.org/f", Err: &net.DNSError{Err: "no such host", Name: "example.org", IsNotFound: true}}, false},
+		{&url.Error{Op: "Put", URL: "https://example.org/f", Err: x509.UnknownAuthorityError{}}, false},
+		{fmt.Errorf("failure reading data: %w", io.ErrUnexpectedEOF), true},
+		{retryableError{errors.New("file size mis-match")}, true},
+	}
+
+	for _, c := range cases {
+		if r := isRetryable(c.err); r != c.retryable {
+			t.Errorf("%v: expected retryable %t, got %t", c.err, c.retryable, r)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+
+	retries = retryPolicy{max: 3, delay: time.Millisecond}
+	defer func() { retries = retryPolicy{max: defaultMaxRetry, delay: defaultRetryDelay} }()
+
+	// retryable errors are retried up to `max` times
+	n := 0
+	err := withRetry(context.Background(), "test", func() error {
+		n++
+		return retryableError{errors.New("transient")}
+	})
+	if err == nil || n != 4 {
+		t.Errorf("expected 4 attempts with error, got %d attempts with %v", n, err)
+	}
+
+	// permanent errors are not retried
+	n = 0
+	withRetry(context.Background(), "test", func() error {
+		n++
+		return errors.New("permanent")
+	})
+	if n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+
+	// success after a transient error
+	n = 0
+	err = withRetry(context.Background(), "test", func() error {
+		n++
+		if n < 2 {
+			return retryableError{errors.New("transient")}
+		}
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("expected success after 2 attempts, got %d attempts with %v", n, err)
+	}
+
+	// the wait for the next attempt is stopped by the cancellation
+	retries.delay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	err = withRetry(ctx, "test", func() error {
+		return retryableError{errors.New("transient")}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(t0) > 10*time.Second {
+		t.Errorf("expected the cancellation after %s, got %v", time.Since(t0), err)
+	}
+}
+
+func TestRetriedMove(t *testing.T) {
+
+	retries = retryPolicy{max: 2, delay: time.Millisecond}
+	defer func() { retries = retryPolicy{max: defaultMaxRetry, delay: defaultRetryDelay} }()
+
+	// the first MOVE is done by the server, but the response is lost as a 503
+	moved, n := false, 0
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "MOVE":
+			n++
+			if moved {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			moved = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Method == "PROPFIND" && r.URL.Path == "/dav/data/b.txt" && moved:
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dav/data/b.txt</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>1</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+</d:multistatus>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	src := pathFileInfo{path: "/data/a.txt", info: testFileInfo{name: "a.txt", size: 1}}
+	if _, _, _, err := cliCopyOrRename(context.Background(), Move, src, "/data/b.txt"); err != nil || n != 2 {
+		t.Errorf("expected success after 2 attempts, got %d attempts with %v", n, err)
+	}
+}
+
+func TestObserveRetryAfter(t *testing.T) {
+
+	defer retryAfter.Store(0)
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "2")
+	observeRetryAfter(resp)
+
+	retries = retryPolicy{max: 1, delay: time.Millisecond}
+	defer func() { retries = retryPolicy{max: defaultMaxRetry, delay: defaultRetryDelay} }()
+
+	if d := backoff(0); d < time.Second || d > 2*time.Second {
+		t.Errorf("expected backoff respecting Retry-After, got %s", d)
+	}
+}
@@ -20,7 +20,7 @@ import (
 
 var verbose bool
 var configFile string
-var nthreads int
+var nthreads threadsValue
 
 var silent bool
 
@@ -110,19 +110,36 @@ func New() *cobra.Command {
 				cfg.ConsoleLevel = log.Info
 			}
 			log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+			// writer of the JSON progress events
+			events = nil
+			if progress == progressJSON {
+				var err error
+				if events, err = newEventWriter(progressFd); err != nil {
+					return err
+				}
+			}
+
 			return initDavClient(!shellMode)
 		},
 	}
 
 	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
-	cmd.PersistentFlags().IntVarP(&nthreads, "nthreads", "n", 4, "`number` of concurrent worker threads.")
+	nthreads = threadsValue{n: defaultThreads}
+	cmd.PersistentFlags().VarP(&nthreads, "nthreads", "n", "`number` of concurrent worker threads, or \"auto\" to adapt it to the server performance.")
 	cmd.PersistentFlags().BoolVarP(&silent, "silent", "s", false, "set to slient mode (i.e. do not show progress)")
+	cmd.PersistentFlags().BoolVarP(&fastListing, "fast-listing", "", false, "list a directory tree with a single PROPFIND request if the server supports infinite depth")
+	progress = progressBar
+	cmd.PersistentFlags().VarP(&progress, "progress", "", "`format` of the progress output: \"bar\" on the terminal, or \"json\" for newline-delimited JSON events")
+	cmd.PersistentFlags().IntVarP(&progressFd, "progress-fd", "", 1, "file descriptor to which the JSON progress events are written")
+	cmd.PersistentFlags().BoolVarP(&traceHTTP, "trace-http", "", false, "print every HTTP request and response to the stderr, with the credentials redacted")
+	cmd.PersistentFlags().StringVarP(&harFile, "har", "", "", "record every HTTP request and response in the HAR `file`")
 
 	if shellMode {
 		cmd.AddCommand(cdCmd, pwdCmd, lcdCmd, lpwdCmd, llsCmd())
 	}
 
-	cmd.AddCommand(versionCmd, lsCmd(), putCmd(), getCmd(), mgetCmd(), mputCmd(), rmCmd(), mvCmd(), cpCmd(), mkdirCmd, configCmd)
+	cmd.AddCommand(versionCmd, lsCmd(), putCmd(), getCmd(), mgetCmd(), mputCmd(), rmCmd(), mvCmd(), cpCmd(), mkdirCmd, infoCmd(), lockCmd(), unlockCmd(), locksCmd(), trashCmd(), undoCmd(), configCmd)
 
 	return cmd
 }
@@ -147,12 +164,19 @@ func initDavClient(prompt bool) error {
 		if cli == nil || (baseURL != "" && baseURL != davBaseURL) {
 			// initiate a new webdav client with new baseURL
 			davBaseURL = baseURL
-			cli = dav.NewClient(baseURL, repoUser, repoPass)
+			newDavClient(repoUser, repoPass)
 		}
-		return nil
+		return configureTransport()
 	}
 }
 
+// newDavClient initiates a new webdav client `cli` on `davBaseURL` with the given credential.
+func newDavClient(user, pass string) {
+	setCredential(user, pass)
+	cli = dav.NewClient(davBaseURL, user, pass)
+	cli.SetTransport(davTransport)
+}
+
 // versionCmd prints out the version number of the package.
 var versionCmd = &cobra.Command{
 	Use:   "version",
@@ -0,0 +1,34 @@
+package repocli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newTestServer starts a WebDAV test server with `handler`, and points the WebDAV client `cli` at the
+// base URL `/dav/` of the server, with the configuration file, and so the state database and the
+// locks file, in a temporary directory.  The client, the credential, the configuration file and the
+// held locks are restored when the test is done.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+
+	prevCli, prevURL, prevConfig := cli, davBaseURL, configFile
+	user, pass, _ := getCredential()
+	t.Cleanup(func() {
+		srv.Close()
+		cli, davBaseURL, configFile = prevCli, prevURL, prevConfig
+		setCredential(user, pass)
+		heldLocks.mutex.Lock()
+		heldLocks.loaded, heldLocks.locks = false, nil
+		heldLocks.mutex.Unlock()
+	})
+
+	davBaseURL = srv.URL + "/dav/"
+	configFile = filepath.Join(t.TempDir(), "repocli.yml")
+	newDavClient("", "")
+	return srv
+}
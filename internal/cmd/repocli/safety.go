@@ -0,0 +1,199 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfirmThreshold is the number of files above which a removal requires confirmation, if
+// not set in the configuration file.
+const defaultConfirmThreshold = 100
+
+// assumeYes skips the confirmation of removing many files or a top-level directory.
+var assumeYes bool
+
+// addConfirmFlag adds the `--yes` flag to the command `cmd` removing or moving away files.
+func addConfirmFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "do not ask for confirmation of removing many files or a top-level directory, e.g. in scripts")
+}
+
+// safetyConfig is the configuration in the `safety` section of the configuration file, for example:
+//
+//	safety:
+//	  confirm_threshold: 500
+//	  protected:
+//	    - /dccn/*/raw
+//	    - /dccn/*/raw/*
+//
+// The patterns of the protected paths have the syntax of `path.Match`, in which `*` does not match
+// the path separator.
+type safetyConfig struct {
+	// ConfirmThreshold is the number of files above which a removal requires confirmation, 0 for the
+	// default and a negative number for never.
+	ConfirmThreshold int `yaml:"confirm_threshold,omitempty"`
+	// Protected are the patterns of the repository paths that can never be removed or moved away.
+	Protected []string `yaml:"protected,omitempty"`
+}
+
+// loadSafetyConfig reads the `safety` section of the configuration file `cfgFile`.  A missing file
+// or section gives the default configuration.
+func loadSafetyConfig(cfgFile string) (safetyConfig, error) {
+	var sections struct {
+		Safety safetyConfig `yaml:"safety"`
+	}
+
+	data, err := os.ReadFile(cfgFile)
+	if os.IsNotExist(err) {
+		return sections.Safety, nil
+	} else if err != nil {
+		return sections.Safety, err
+	}
+
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return sections.Safety, fmt.Errorf("invalid safety configuration: %s", err)
+	}
+	for _, pattern := range sections.Safety.Protected {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return sections.Safety, fmt.Errorf("invalid protected path %q: %s", pattern, err)
+		}
+	}
+	return sections.Safety, nil
+}
+
+// threshold returns the number of files above which a removal requires confirmation, or -1 if
+// the number of files never requires confirmation.
+func (c safetyConfig) threshold() int {
+	switch {
+	case c.ConfirmThreshold == 0:
+		return defaultConfirmThreshold
+	case c.ConfirmThreshold < 0:
+		return -1
+	}
+	return c.ConfirmThreshold
+}
+
+// protects returns the pattern protecting the repository path `p`.  The path is protected if it
+// matches a pattern, or if it may contain a path matching a pattern, i.e. the leading elements
+// of the pattern match `p`.
+func (c safetyConfig) protects(p string) (string, bool) {
+	elems := strings.Split(strings.TrimSuffix(path.Clean(p), "/"), "/")
+	for _, pattern := range c.Protected {
+		pelems := strings.Split(strings.TrimSuffix(path.Clean(pattern), "/"), "/")
+		if len(pelems) < len(elems) {
+			continue
+		}
+		if ok, _ := path.Match(strings.Join(pelems[:len(elems)], "/"), strings.Join(elems, "/")); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// isTopLevel checks whether the repository path `p` is a collection, or a directory directly
+// within a collection, e.g. `/dccn/DAC_3010000.01_173/raw`.
+func isTopLevel(p string) bool {
+	return len(strings.Split(strings.Trim(path.Clean(p), "/"), "/")) <= 3
+}
+
+// countRepoFiles returns the number of files in the repository directory `p` and its
+// sub-directories.
+func countRepoFiles(ctx context.Context, p string) int {
+
+	var mutex sync.Mutex
+	n := 0
+
+	w := treeWalker{
+		list:    listRepo,
+		tree:    listRepoTree,
+		joinSrc: path.Join,
+		joinDst: path.Join,
+		onList: func(dir opInput, files []fs.FileInfo) {
+			mutex.Lock()
+			n += int(countFiles(files))
+			mutex.Unlock()
+		},
+	}
+
+	// the files are pushed by the walker for the operations, which are not needed for counting.
+	ichan := make(chan opInput, opQueueSize)
+	go func() {
+		for range ichan {
+		}
+	}()
+	if err := w.walk(ctx, opInput{src: pathFileInfo{path: p}}, ichan); err != nil {
+		log.Warnf("counted files in %s partially: %s", p, err)
+	}
+	close(ichan)
+
+	return n
+}
+
+// guardRemoval checks that the repository file or directory `p` can be removed or moved away by
+// `action`, e.g. "removing".  A protected path is refused.  Removing more files than the threshold,
+// or a top-level directory, is confirmed by the user unless `assumeYes` is set or in the dry-run
+// mode.  The files in a directory are counted if `count` is set, and always in the shell mode to
+// show the number of affected files.
+func guardRemoval(ctx context.Context, action, p string, info fs.FileInfo, count bool) error {
+
+	c, err := loadSafetyConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if pattern, ok := c.protects(p); ok {
+		return fmt.Errorf("%s is protected by the pattern %q in %s", p, pattern, configFile)
+	}
+	if assumeYes || plan != nil {
+		return nil
+	}
+
+	n := -1
+	if !info.IsDir() {
+		n = 1
+	} else if count || shellMode {
+		n = countRepoFiles(ctx, p)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	var reasons []string
+	if info.IsDir() && isTopLevel(p) {
+		reasons = append(reasons, "a top-level directory")
+	}
+	if c.threshold() >= 0 && n > c.threshold() {
+		reasons = append(reasons, fmt.Sprintf("more than %d files", c.threshold()))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	what := p
+	if n >= 0 {
+		what = fmt.Sprintf("%s with %d files", p, n)
+	}
+	return confirm(fmt.Sprintf("%s %s, %s", action, what, strings.Join(reasons, " and ")))
+}
+
+// confirm asks the user to confirm the action described by `msg`.  It returns an error if the
+// action is not confirmed, or if the standard input is not a terminal.
+func confirm(msg string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("%s: confirmation required, use --yes to proceed", msg)
+	}
+	a := stringPrompt(fmt.Sprintf("\n%s, continue? [y/N]", msg))
+	if a = strings.ToLower(a); a == "y" || a == "yes" {
+		log.Debugf("confirmed: %s", msg)
+		return nil
+	}
+	return fmt.Errorf("%s: not confirmed", msg)
+}
@@ -0,0 +1,63 @@
+package repocli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafetyConfig(t *testing.T) {
+
+	f := filepath.Join(t.TempDir(), "repocli.yml")
+	os.WriteFile(f, []byte(`
+repository:
+  baseurl: https://webdav.example.org/
+safety:
+  confirm_threshold: -1
+  protected:
+    - /dccn/*/raw
+`), 0600)
+
+	c, err := loadSafetyConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.threshold() != -1 {
+		t.Errorf("unexpected threshold %d", c.threshold())
+	}
+	for p, protected := range map[string]bool{
+		"/dccn/DAC_3010000.01_173/raw":       true,
+		"/dccn/DAC_3010000.01_173/raw/a.txt": false,
+		"/dccn/DAC_3010000.01_173/":          true,
+		"/dccn":                              true,
+		"/":                                  true,
+		"/dccn/DAC_3010000.01_173/derived":   false,
+		"/other/DAC_3010000.01_173":          false,
+	} {
+		if _, ok := c.protects(p); ok != protected {
+			t.Errorf("%s: protected %t, expected %t", p, ok, protected)
+		}
+	}
+
+	if c, _ := loadSafetyConfig(filepath.Join(t.TempDir(), "none.yml")); c.threshold() != defaultConfirmThreshold {
+		t.Errorf("unexpected default threshold %d", c.threshold())
+	}
+
+	os.WriteFile(f, []byte("safety:\n  protected:\n    - /dccn/[\n"), 0600)
+	if _, err := loadSafetyConfig(f); err == nil || !strings.Contains(err.Error(), "invalid protected path") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+}
+
+func TestIsTopLevel(t *testing.T) {
+	for p, expected := range map[string]bool{
+		"/dccn/DAC_3010000.01_173":          true,
+		"/dccn/DAC_3010000.01_173/raw":      true,
+		"/dccn/DAC_3010000.01_173/raw/sub1": false,
+	} {
+		if isTopLevel(p) != expected {
+			t.Errorf("%s: top-level %t, expected %t", p, !expected, expected)
+		}
+	}
+}
@@ -1,22 +1,18 @@
 package repocli
 
 import (
-	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"syscall"
-	"time"
 
 	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	dav "github.com/studio-b12/gowebdav"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v2"
 )
@@ -135,25 +131,19 @@ The "lls" subcommand is for listing files and directories at local, with wildcar
 				}
 			}
 
-			files := make([]fs.FileInfo, 0)
+			entries := make([]listEntry, 0)
 			if f, err := os.Stat(p); err == nil {
 				if !f.IsDir() {
 					// user input is a file
-					p = filepath.Dir(p)
-					files = append(files, f)
+					entries = append(entries, newListEntry(p, f))
 				} else {
-					// user input is a directory
-					entries, err := os.ReadDir(p)
-					if err != nil {
+					// user input is a directory, listed recursively if requested
+					w := treeWalker{list: listLocal, joinSrc: filepath.Join}
+					if entries, err = listEntries(context.Background(), p, w, filepath.Join); err != nil {
+						// the entries listed are shown before the error
+						printEntries(entries)
 						return err
 					}
-					for _, entry := range entries {
-						if info, err := entry.Info(); err != nil {
-							log.Errorf("%s: %s", err, entry.Name())
-						} else {
-							files = append(files, info)
-						}
-					}
 				}
 			} else if errors.Is(err, os.ErrNotExist) && len(args) == 1 {
 				// assuming the user input is a wildcard
@@ -161,26 +151,13 @@ The "lls" subcommand is for listing files and directories at local, with wildcar
 				if matches, err := filepath.Glob(args[0]); err == nil && matches != nil {
 					for _, m := range matches {
 						if f, err := os.Stat(m); err == nil {
-							files = append(files, f)
+							entries = append(entries, newListEntry(filepath.Join(p, f.Name()), f))
 						}
 					}
 				}
 			}
 
-			if longformat {
-				for _, f := range files {
-					fmt.Printf("%11s %12d %s %s\n", f.Mode(), f.Size(), f.ModTime().Format(time.UnixDate), filepath.Join(p, f.Name()))
-				}
-			} else {
-				isDirMarker := make(map[bool]rune, 2)
-				isDirMarker[true] = '/'
-				isDirMarker[false] = 0
-
-				for _, f := range files {
-					fmt.Printf("%s%c\n", f.Name(), isDirMarker[f.Mode().IsDir()])
-				}
-			}
-			return nil
+			return printEntries(entries)
 		},
 		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			// get list of content in this directory
@@ -196,6 +173,7 @@ The "lls" subcommand is for listing files and directories at local, with wildcar
 	}
 
 	cmd.Flags().BoolVarP(&longformat, "long", "l", false, "list files with more detail")
+	addListingFlags(cmd)
 
 	return cmd
 }
@@ -258,12 +236,16 @@ func promptConfig(saveCredential bool) error {
 	}
 
 	// try to connect the repo webdav to check authentication
-	cli = dav.NewClient(davBaseURL, repoUser, repoPass)
+	if err := configureTransport(); err != nil {
+		return err
+	}
+	newDavClient(repoUser, repoPass)
 	if err := cli.Connect(); err != nil {
 		return err
 	}
 
-	// save to configuration file `configFile`
+	// save to configuration file `configFile`, with the password renewed during the connection if any
+	repoUser, repoPass, _ = getCredential()
 	return saveConfig(davBaseURL, repoUser, repoPass, saveCredential)
 }
 
@@ -287,24 +269,31 @@ func saveConfig(baseURL, username, password string, saveCredential bool) error {
 		cfg.Password = hex.EncodeToString(epass)
 	}
 
-	conf, err := yaml.Marshal(&struct {
-		Repository config.RepositoryConfiguration `yaml:"repository"`
-	}{
-		cfg,
-	})
+	// keep the other sections of an existing configuration file, e.g. `transport`
+	var sections yaml.MapSlice
+	if data, err := os.ReadFile(configFile); err == nil {
+		if err := yaml.Unmarshal(data, &sections); err != nil {
+			return fmt.Errorf("cannot parse %s: %s", configFile, err)
+		}
+	}
 
-	if err != nil {
-		return err
+	i := 0
+	for ; i < len(sections); i++ {
+		if sections[i].Key == "repository" {
+			break
+		}
+	}
+	if i == len(sections) {
+		sections = append(sections, yaml.MapItem{Key: "repository"})
 	}
+	sections[i].Value = cfg
 
-	vconf := viper.New()
-	vconf.SetConfigType("yaml")
-	err = vconf.ReadConfig(bytes.NewBuffer(conf))
+	conf, err := yaml.Marshal(sections)
 	if err != nil {
 		return err
 	}
 
-	if err := vconf.WriteConfigAs(configFile); err != nil {
+	if err := os.WriteFile(configFile, conf, 0600); err != nil {
 		return err
 	}
 
@@ -0,0 +1,123 @@
+package repocli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// transferRecord is the state of a local file kept after it has been transferred
+// from/to the repository file `Remote`.
+type transferRecord struct {
+	Remote  string    `json:"remote"`
+	ETag    string    `json:"etag"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// stateMutex serialises the access to the local state database within the process, as the file
+// lock of the database also excludes the other handles opened by the same process.
+var stateMutex sync.Mutex
+
+// getStatePath returns the path of the local state database, which is located next to
+// the configuration file `configFile` so that each WebDAV endpoint has its own state.
+func getStatePath() string {
+	p, _ := filepath.Abs(configFile)
+	return strings.TrimSuffix(p, filepath.Ext(p)) + ".db"
+}
+
+// openStateDB opens the local state database, read-only with a shared file lock if `readOnly` is
+// set.  The database is opened per transaction and closed right after, so that the file lock is
+// not held across the transactions, e.g. during a long transfer or an open shell session, in
+// which case other repocli processes could not use the database.  The caller must hold `stateMutex`.
+func openStateDB(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(getStatePath(), 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open state db %s: %s", getStatePath(), err)
+	}
+	return db, nil
+}
+
+// getState unmarshals the value of `key` within `bucket` into `obj`.
+func getState(bucket, key string, obj interface{}) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	// a read-only database cannot be created
+	if _, err := os.Stat(getStatePath()); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("key %s not in bucket %s", key, bucket)
+	}
+
+	db, err := openStateDB(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		var v []byte
+		if b := tx.Bucket([]byte(bucket)); b != nil {
+			v = b.Get([]byte(key))
+		}
+		if v == nil {
+			return fmt.Errorf("key %s not in bucket %s", key, bucket)
+		}
+		return json.Unmarshal(v, obj)
+	})
+}
+
+// updateState calls `fn` with `bucket` in a read-write transaction, creating the bucket if needed.
+func updateState(bucket string, fn func(b *bolt.Bucket) error) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	db, err := openStateDB(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return fn(b)
+	})
+}
+
+// setState marshals `obj` as the value of `key` within `bucket`.
+func setState(bucket, key string, obj interface{}) error {
+	v, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return updateState(bucket, func(b *bolt.Bucket) error {
+		return b.Put([]byte(key), v)
+	})
+}
+
+// getTransferRecord returns the transfer record of the local file `localPath`.
+func getTransferRecord(localPath string) (r transferRecord, err error) {
+	err = getState("transfer", localPath, &r)
+	return
+}
+
+// setTransferRecord saves the transfer record of the local file `localPath`.
+func setTransferRecord(localPath string, r transferRecord) error {
+	return setState("transfer", localPath, &r)
+}
+
+// deleteState removes `key` from `bucket`.
+func deleteState(bucket, key string) error {
+	return updateState(bucket, func(b *bolt.Bucket) error {
+		return b.Delete([]byte(key))
+	})
+}
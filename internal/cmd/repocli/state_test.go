@@ -0,0 +1,42 @@
+package repocli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestState(t *testing.T) {
+
+	defer func(p string) { configFile = p }(configFile)
+	configFile = filepath.Join(t.TempDir(), "repocli.yml")
+
+	var r transferRecord
+	if err := getState("transfer", "/local/a.txt", &r); err == nil {
+		t.Errorf("expected no record in a new state db")
+	}
+
+	expected := transferRecord{Remote: "/data/a.txt", ETag: `"abc"`, Size: 10}
+	if err := setTransferRecord("/local/a.txt", expected); err != nil {
+		t.Fatal(err)
+	}
+
+	// the database is not held between the transactions, e.g. by another repocli process.
+	db, err := bolt.Open(getStatePath(), 0600, &bolt.Options{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("state db held after the transaction: %s", err)
+	}
+	db.Close()
+
+	if r, err = getTransferRecord("/local/a.txt"); err != nil || r != expected {
+		t.Errorf("unexpected record %+v (%v)", r, err)
+	}
+	if err := deleteState("transfer", "/local/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := getState("transfer", "/local/a.txt", &r); err == nil {
+		t.Errorf("expected the record to be deleted")
+	}
+}
@@ -0,0 +1,342 @@
+package repocli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Donders-Institute/dr-tools/internal/cmd/version"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// traceHTTP enables printing every HTTP request and response to the stderr.
+var traceHTTP bool
+
+// harFile is the path of the file in which every HTTP request and response is recorded in the HAR format.
+var harFile string
+
+// maxHarContent is the maximum size of the PROPFIND bodies recorded in the HAR file.
+const maxHarContent = 1024 * 1024
+
+// redactedHeaders are the headers of which the values are not printed nor recorded.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// traceTransport is a `http.RoundTripper` printing and recording the HTTP requests and responses
+// if `traceHTTP` or `harFile` is set.  The headers with credentials are redacted.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the `http.RoundTripper` interface.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if !traceHTTP && harFile == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	e := &harEntry{
+		StartedDateTime: time.Now().Format(time.RFC3339Nano),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			Cookies:     []harNameValue{},
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Cache: struct{}{},
+	}
+
+	// record the PROPFIND body, and count the bytes of other bodies
+	r := req
+	var sent *countingBody
+	if req.Body != nil {
+		if req.Method == "PROPFIND" && req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				b, _ := io.ReadAll(io.LimitReader(body, maxHarContent))
+				body.Close()
+				e.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(b)}
+			}
+		}
+		sent = &countingBody{ReadCloser: req.Body}
+		r = req.Clone(req.Context())
+		r.Body = sent
+	}
+
+	if traceHTTP {
+		var b strings.Builder
+		fmt.Fprintf(&b, "> %s %s %s\n", req.Method, req.URL, req.Proto)
+		for _, h := range e.Request.Headers {
+			fmt.Fprintf(&b, "> %s: %s\n", h.Name, h.Value)
+		}
+		fmt.Fprint(os.Stderr, b.String())
+	}
+
+	t0 := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	wait := time.Since(t0)
+
+	if err != nil {
+		if traceHTTP {
+			fmt.Fprintf(os.Stderr, "< %s %s: %s (%s)\n", req.Method, req.URL, err, wait.Round(time.Millisecond))
+		}
+		e.Error = err.Error()
+		e.Request.BodySize = sent.count(e.Request.BodySize)
+		e.Response = harResponse{Headers: []harNameValue{}, Cookies: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		e.Time = ms(wait)
+		e.Timings = harTimings{Send: 0, Wait: ms(wait), Receive: 0}
+		recordHar(e)
+		return resp, err
+	}
+
+	if traceHTTP {
+		var b strings.Builder
+		fmt.Fprintf(&b, "< %s %s (%s)\n", resp.Proto, resp.Status, wait.Round(time.Millisecond))
+		for _, h := range harHeaders(resp.Header) {
+			fmt.Fprintf(&b, "< %s: %s\n", h.Name, h.Value)
+		}
+		fmt.Fprint(os.Stderr, b.String())
+	}
+
+	e.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harNameValue{},
+		Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+		HeadersSize: -1,
+	}
+
+	// the entry is recorded once the response body is read and closed
+	resp.Body = &tracedBody{
+		ReadCloser: resp.Body,
+		entry:      e,
+		sent:       sent,
+		start:      t0,
+		wait:       wait,
+		capture:    req.Method == "PROPFIND",
+	}
+	return resp, nil
+}
+
+// countingBody is a request body counting the bytes read.  The count is atomic, as the body may
+// still be read by the transport while the entry of the response is recorded.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+// Read implements the `io.Reader` interface.
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// count returns the number of bytes read from the body, or `size` if there is no body.
+func (b *countingBody) count(size int64) int64 {
+	if b == nil {
+		return size
+	}
+	return b.n.Load()
+}
+
+// tracedBody is a response body counting, and optionally capturing, the bytes read.  The HAR
+// entry of the response is recorded when the body is closed.
+type tracedBody struct {
+	io.ReadCloser
+	entry   *harEntry
+	sent    *countingBody
+	start   time.Time
+	wait    time.Duration
+	capture bool
+	content bytes.Buffer
+	once    sync.Once
+}
+
+// Read implements the `io.Reader` interface.
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.entry.Response.BodySize += int64(n)
+	if b.capture && b.content.Len() < maxHarContent {
+		b.content.Write(p[:n])
+	}
+	return n, err
+}
+
+// Close implements the `io.Closer` interface.
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		total := time.Since(b.start)
+		b.entry.Time = ms(total)
+		b.entry.Timings = harTimings{Send: 0, Wait: ms(b.wait), Receive: ms(total - b.wait)}
+		b.entry.Response.Content.Size = b.entry.Response.BodySize
+		b.entry.Request.BodySize = b.sent.count(b.entry.Request.BodySize)
+		if b.capture {
+			b.entry.Response.Content.Text = b.content.String()
+		}
+		recordHar(b.entry)
+	})
+	return err
+}
+
+// ms returns the duration `d` in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harHeaders returns the headers `h` in the HAR format, sorted by name and with the credentials redacted.
+func harHeaders(h http.Header) []harNameValue {
+	headers := make([]harNameValue, 0, len(h))
+	for k, vals := range h {
+		for _, v := range vals {
+			if redactedHeaders[k] {
+				v = "REDACTED"
+			}
+			headers = append(headers, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// harLog is the HAR file being written.  The file is kept a valid HAR document after every entry,
+// by overwriting the closing `harTrailer` with the next entry.
+var harLog struct {
+	mutex    sync.Mutex
+	path     string
+	f        *os.File
+	nentries int
+}
+
+const harTrailer = "\n]}}\n"
+
+// recordHar appends the entry `e` to the HAR file `harFile`.  The file is (re-)created when the
+// first entry is recorded into it.
+func recordHar(e *harEntry) {
+	if harFile == "" {
+		return
+	}
+
+	harLog.mutex.Lock()
+	defer harLog.mutex.Unlock()
+
+	if harLog.path != harFile {
+		if harLog.f != nil {
+			harLog.f.Close()
+		}
+		harLog.f, harLog.path, harLog.nentries = nil, harFile, 0
+
+		f, err := os.OpenFile(harFile, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+		if err != nil {
+			log.Errorf("cannot create HAR file %s: %s", harFile, err)
+			return
+		}
+		creator := fmt.Sprintf(`{"log":{"version":"1.2","creator":{"name":"repocli","version":%q},"entries":[`, version.Version)
+		if _, err := f.WriteString(creator + harTrailer); err != nil {
+			log.Errorf("cannot write HAR file %s: %s", harFile, err)
+			f.Close()
+			return
+		}
+		harLog.f = f
+	}
+
+	if harLog.f == nil {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("cannot encode HAR entry: %s", err)
+		return
+	}
+
+	sep := "\n"
+	if harLog.nentries > 0 {
+		sep = ",\n"
+	}
+
+	if _, err := harLog.f.Seek(-int64(len(harTrailer)), io.SeekEnd); err == nil {
+		_, err = harLog.f.WriteString(sep + string(data) + harTrailer)
+		if err != nil {
+			log.Errorf("cannot write HAR file %s: %s", harFile, err)
+			return
+		}
+	}
+	harLog.nentries++
+}
+
+// harEntry and the types below are the parts of the HAR 1.2 format recorded for every request.
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Error is the error of a request that has no response.
+	Error string `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
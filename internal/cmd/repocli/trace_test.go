@@ -0,0 +1,80 @@
+package repocli
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceTransport(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		if r.Method == "PROPFIND" {
+			w.WriteHeader(http.StatusMultiStatus)
+			io.WriteString(w, "<multistatus/>")
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	harFile = filepath.Join(t.TempDir(), "trace.har")
+	defer func() { harFile = "" }()
+
+	client := &http.Client{Transport: &traceTransport{next: http.DefaultTransport}}
+
+	req, _ := http.NewRequest("PROPFIND", srv.URL, strings.NewReader("<propfind/>"))
+	req.SetBasicAuth("user", "secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("data"))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "s1") {
+		t.Errorf("credentials not redacted: %s", data)
+	}
+
+	var har struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("invalid HAR file: %s", err)
+	}
+	if n := len(har.Log.Entries); n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+
+	e := har.Log.Entries[0]
+	if e.Request.Method != "PROPFIND" || e.Request.PostData == nil || e.Request.PostData.Text != "<propfind/>" {
+		t.Errorf("unexpected PROPFIND request: %+v", e.Request)
+	}
+	if e.Response.Status != http.StatusMultiStatus || e.Response.Content.Text != "<multistatus/>" {
+		t.Errorf("unexpected PROPFIND response: %+v", e.Response)
+	}
+
+	e = har.Log.Entries[1]
+	if e.Request.Method != http.MethodPut || e.Request.BodySize != 4 || e.Request.PostData != nil {
+		t.Errorf("unexpected PUT request: %+v", e.Request)
+	}
+}
@@ -0,0 +1,267 @@
+package repocli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// davTransport is the HTTP transport of the WebDAV client `cli`.
+var davTransport http.RoundTripper = newDavTransport(http.DefaultTransport)
+
+// davTransportConfig is the configuration from which the current `davTransport` is made.
+var davTransportConfig transportConfig
+
+// newDavTransport returns the transport of the WebDAV client on top of the HTTP transport `base`.
+func newDavTransport(base http.RoundTripper) http.RoundTripper {
+	return &observedTransport{
+		next: &sessionTransport{
+			next: &lockTransport{
+				next: &traceTransport{next: base},
+			},
+		},
+	}
+}
+
+// transportConfig is the configuration of the HTTP transport in the `transport` section of the
+// configuration file.  The section has the options for all endpoints under the key `default`,
+// and the options for specific endpoints under the base URL, for example:
+//
+//	transport:
+//	  default:
+//	    connect_timeout: 10s
+//	    proxy: http://proxy.example.org:8080
+//	  https://webdav.test.example.org/:
+//	    ca_bundle: /etc/ssl/test-ca.pem
+//	    tls_min_version: "1.3"
+//
+// The options of the endpoint override those of `default`.
+type transportConfig struct {
+	// ConnectTimeout is the timeout for establishing a connection.
+	ConnectTimeout time.Duration `yaml:"connect_timeout,omitempty"`
+	// ReadTimeout is the timeout for waiting for the response headers after sending a request.
+	ReadTimeout time.Duration `yaml:"read_timeout,omitempty"`
+	// MaxIdleConns is the size of the pool of keep-alive connections.
+	MaxIdleConns int `yaml:"max_idle_conns,omitempty"`
+	// Proxy is the URL of the proxy overriding the HTTP(S)_PROXY environment variables, or
+	// "none" for not using a proxy.
+	Proxy string `yaml:"proxy,omitempty"`
+	// CABundle is the path of a PEM file with CA certificates trusted in addition to the system's.
+	CABundle string `yaml:"ca_bundle,omitempty"`
+	// ClientCert and ClientKey are the paths of the PEM files of the client certificate and its key.
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+	// TLSMinVersion is the minimum TLS version, i.e. "1.0", "1.1", "1.2" or "1.3".
+	TLSMinVersion string `yaml:"tls_min_version,omitempty"`
+	// UserAgent is the User-Agent header of all requests.
+	UserAgent string `yaml:"user_agent,omitempty"`
+	// Headers are additional headers of all requests.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// tlsVersions maps the supported values of `tls_min_version`.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// loadTransportConfig reads the transport configuration of the endpoint `baseURL` from the
+// configuration file `cfgFile`.  A missing file or section gives the default configuration.
+func loadTransportConfig(cfgFile, baseURL string) (transportConfig, error) {
+	var c transportConfig
+
+	data, err := os.ReadFile(cfgFile)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+
+	var sections struct {
+		Transport map[string]interface{} `yaml:"transport"`
+	}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return c, err
+	}
+
+	// decode the endpoint options on top of the default ones
+	keys := []string{"default"}
+	for k := range sections.Transport {
+		if k != "default" && strings.TrimSuffix(k, "/") == strings.TrimSuffix(baseURL, "/") {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		v, ok := sections.Transport[k]
+		if !ok {
+			continue
+		}
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return c, err
+		}
+		if err := yaml.UnmarshalStrict(b, &c); err != nil {
+			return c, fmt.Errorf("invalid transport configuration of %s: %s", k, err)
+		}
+	}
+	return c, nil
+}
+
+// newHTTPTransport makes a HTTP transport with the configuration `c`.
+func newHTTPTransport(c transportConfig) (http.RoundTripper, error) {
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.ConnectTimeout > 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   c.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	t.ResponseHeaderTimeout = c.ReadTimeout
+
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+		t.MaxIdleConnsPerHost = c.MaxIdleConns
+	}
+
+	switch c.Proxy {
+	case "":
+	case "none":
+		t.Proxy = nil
+	default:
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %s", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if c.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle: %s", c.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.TLSMinVersion != "" {
+		v, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version: %s", c.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = v
+	}
+
+	t.TLSClientConfig = tlsConfig
+
+	if c.UserAgent == "" && len(c.Headers) == 0 {
+		return t, nil
+	}
+
+	headers := http.Header{}
+	for k, v := range c.Headers {
+		headers.Set(k, v)
+	}
+	if c.UserAgent != "" {
+		headers.Set("User-Agent", c.UserAgent)
+	}
+	return &headerTransport{next: t, headers: headers}, nil
+}
+
+// configureTransport applies the transport configuration of the endpoint `davBaseURL` in the configuration
+// file `configFile` to the transport `davTransport`.  The transport is only re-made if the configuration
+// has changed, so that the keep-alive connections are reused across the commands in the shell mode.
+func configureTransport() error {
+	c, err := loadTransportConfig(configFile, davBaseURL)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(c, davTransportConfig) {
+		return nil
+	}
+
+	t, err := newHTTPTransport(c)
+	if err != nil {
+		return err
+	}
+	log.Debugf("transport configuration: %+v", c)
+
+	davTransport = newDavTransport(t)
+	davTransportConfig = c
+	if cli != nil {
+		cli.SetTransport(davTransport)
+	}
+	return nil
+}
+
+// headerTransport is a `http.RoundTripper` adding the configured headers to every request.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+// RoundTrip implements the `http.RoundTripper` interface.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	for k, v := range t.headers {
+		r.Header[k] = v
+	}
+	return t.next.RoundTrip(r)
+}
+
+// observedTransport is a `http.RoundTripper` reporting the status code and latency of
+// every response to the adaptive concurrency limiter, and keeping the `Retry-After` of
+// throttling responses for the retry backoff.
+type observedTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the `http.RoundTripper` interface.
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t0 := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	observeRetryAfter(resp)
+
+	// the latency of an upload is dominated by the data transfer, and is therefore left out.
+	if req.Method == http.MethodPut {
+		observeResponse(resp.StatusCode, 0)
+	} else {
+		observeResponse(resp.StatusCode, time.Since(t0))
+	}
+	return resp, err
+}
@@ -0,0 +1,108 @@
+package repocli
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTransportConfig = `
+repository:
+  baseurl: https://webdav.example.org/
+  username: user
+transport:
+  default:
+    connect_timeout: 10s
+    proxy: http://proxy.example.org:8080
+    headers:
+      X-Project: "3010000.01"
+  https://webdav.test.example.org:
+    proxy: none
+    tls_min_version: "1.3"
+    user_agent: repocli-test
+`
+
+func TestLoadTransportConfig(t *testing.T) {
+
+	f := filepath.Join(t.TempDir(), "repocli.yml")
+	if err := os.WriteFile(f, []byte(testTransportConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// default options only
+	c, err := loadTransportConfig(f, "https://webdav.example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ConnectTimeout != 10*time.Second || c.Proxy != "http://proxy.example.org:8080" || c.TLSMinVersion != "" {
+		t.Errorf("unexpected default configuration: %+v", c)
+	}
+
+	// endpoint options on top of the default ones
+	c, err = loadTransportConfig(f, "https://webdav.test.example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ConnectTimeout != 10*time.Second || c.Proxy != "none" || c.TLSMinVersion != "1.3" || c.Headers["X-Project"] != "3010000.01" {
+		t.Errorf("unexpected endpoint configuration: %+v", c)
+	}
+
+	tr, err := newHTTPTransport(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht, ok := tr.(*headerTransport)
+	if !ok {
+		t.Fatalf("expected headers transport, got %T", tr)
+	}
+	if ht.headers.Get("User-Agent") != "repocli-test" {
+		t.Errorf("unexpected headers: %v", ht.headers)
+	}
+	if base := ht.next.(*http.Transport); base.Proxy != nil || base.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected transport: proxy set %t, TLS min version %x", base.Proxy != nil, base.TLSClientConfig.MinVersion)
+	}
+
+	// a missing configuration file gives the defaults
+	if c, err := loadTransportConfig(filepath.Join(t.TempDir(), "none.yml"), ""); err != nil || c.ConnectTimeout != 0 {
+		t.Errorf("unexpected configuration without file: %+v, %v", c, err)
+	}
+
+	// unknown options are rejected
+	if err := os.WriteFile(f, []byte("transport:\n  default:\n    timeout: 10s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTransportConfig(f, ""); err == nil {
+		t.Errorf("expected error on unknown option")
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Agent", r.UserAgent())
+		w.Header().Set("X-Project", r.Header.Get("X-Project"))
+	}))
+	defer srv.Close()
+
+	tr, err := newHTTPTransport(transportConfig{
+		UserAgent: "repocli-test",
+		Headers:   map[string]string{"X-Project": "3010000.01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("X-Agent") != "repocli-test" || resp.Header.Get("X-Project") != "3010000.01" {
+		t.Errorf("unexpected request headers: %v", resp.Header)
+	}
+}
@@ -0,0 +1,320 @@
+package repocli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/spf13/cobra"
+	dav "github.com/studio-b12/gowebdav"
+)
+
+// trashDirName is the name of the trash folder within a collection.  The removed items are
+// kept in the trash folder per user, i.e. `<collection>/.repocli-trash/<user>/<id>/`.
+const trashDirName = ".repocli-trash"
+
+// trashInfoName is the name of the file with the metadata of a trashed item, which is kept
+// next to the item in its trash directory.
+const trashInfoName = "trashinfo.json"
+
+var useTrash bool
+var trashCollection string
+var trashRestoreTo string
+var trashOlderThan time.Duration
+
+// trashInfo is the metadata of an item removed into the trash.
+type trashInfo struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	User    string    `json:"user"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// item returns the path of the trashed item within the trash folder `root`.
+func (t trashInfo) item(root string) string {
+	return path.Join(root, t.ID, path.Base(t.Path))
+}
+
+// trashRoot returns the trash folder of the current user for the collection containing the
+// repository path `p`, i.e. the first two levels of `p`, e.g. `/dccn/DAC_3010000.01_173`.
+func trashRoot(p string) (string, error) {
+	parts := strings.Split(strings.Trim(path.Clean(p), "/"), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		return "", fmt.Errorf("not within a collection: %s", p)
+	}
+	user, _, _ := getCredential()
+	if user == "" {
+		user = "anonymous"
+	}
+	return path.Join("/", parts[0], parts[1], trashDirName, strings.ReplaceAll(user, "/", "_")), nil
+}
+
+// newTrashID returns a new ID of a trashed item, which sorts in the order of removal.
+func newTrashID() string {
+	return time.Now().UTC().Format("20060102-150405.000000")
+}
+
+// moveToTrash moves the repository file or directory `p` into the trash folder of its collection,
+// with its metadata.  It returns the metadata and the trash folder.
+func moveToTrash(ctx context.Context, p string, info fs.FileInfo) (t trashInfo, root string, err error) {
+
+	if root, err = trashRoot(p); err != nil {
+		return
+	}
+	if len(strings.Split(strings.Trim(p, "/"), "/")) <= 2 {
+		err = fmt.Errorf("cannot move a collection into its own trash: %s", p)
+		return
+	}
+	if p == path.Dir(root) || isAncestor(path.Dir(root), p) {
+		err = fmt.Errorf("already in the trash, use \"trash empty\" to remove it: %s", p)
+		return
+	}
+
+	user, _, _ := getCredential()
+	t = trashInfo{
+		ID:      newTrashID(),
+		Path:    p,
+		Dir:     info.IsDir(),
+		Size:    info.Size(),
+		User:    user,
+		Deleted: time.Now(),
+	}
+
+	if plan != nil {
+		plan.add(planMove, p, t.item(root), t.Size)
+		return
+	}
+
+	dir := path.Join(root, t.ID)
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = mkdirRepo(ctx, dir, 0755, true); err != nil {
+		return
+	}
+	if err = cli.Write(path.Join(dir, trashInfoName), b, 0644); err != nil {
+		cli.RemoveAll(dir)
+		return
+	}
+	if err = moveRepoIf(ctx, p, t.item(root), precondition{absent: true}); err != nil {
+		cli.RemoveAll(dir)
+		return
+	}
+	log.Debugf("moved %s into the trash %s", p, dir)
+	return
+}
+
+// listTrash returns the metadata of the items in the trash folder `root`, in the order of removal.
+// Directories in the trash folder without valid metadata are left out.
+func listTrash(root string) ([]trashInfo, error) {
+
+	files, err := cli.ReadDir(root)
+	if err != nil {
+		if dav.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	items := []trashInfo{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		var t trashInfo
+		b, err := cli.Read(path.Join(root, f.Name(), trashInfoName))
+		if err == nil {
+			err = json.Unmarshal(b, &t)
+		}
+		if err != nil || t.ID != f.Name() {
+			log.Warnf("skipping %s without valid metadata: %v", path.Join(root, f.Name()), err)
+			continue
+		}
+		items = append(items, t)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// getTrashInfo returns the metadata of the item `id` in the trash folder `root`.
+func getTrashInfo(root, id string) (t trashInfo, err error) {
+	b, err := cli.Read(path.Join(root, id, trashInfoName))
+	if err != nil {
+		if dav.IsErrNotFound(err) {
+			err = fmt.Errorf("no item %s in the trash %s", id, root)
+		}
+		return
+	}
+	err = json.Unmarshal(b, &t)
+	return
+}
+
+// restoreFromTrash moves the item `t` in the trash folder `root` back to its original path, or to
+// `dst` if it is not empty.  It refuses to overwrite an existing file or directory.
+func restoreFromTrash(ctx context.Context, t trashInfo, root, dst string) (string, error) {
+
+	if dst == "" {
+		dst = t.Path
+	}
+	if err := mkdirRepo(ctx, path.Dir(dst), 0755, true); err != nil {
+		return dst, err
+	}
+	if err := moveRepoIf(ctx, t.item(root), dst, precondition{absent: true}); err != nil {
+		if errors.Is(err, errChangedRemotely) {
+			return dst, fmt.Errorf("cannot restore %s: %s exists", t.ID, dst)
+		}
+		return dst, err
+	}
+	return dst, withRetry(ctx, "remove "+path.Join(root, t.ID), func() error {
+		return cli.RemoveAll(path.Join(root, t.ID))
+	})
+}
+
+// getTrashRoot returns the trash folder of the collection given by the "--collection" flag, or of
+// the current directory.
+func getTrashRoot() (string, error) {
+	p := cwd
+	if trashCollection != "" {
+		p = getCleanRepoPath(trashCollection)
+	}
+	return trashRoot(p)
+}
+
+// command to manage the items removed into the trash.
+func trashCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "list, restore or empty the items removed into the trash",
+		Long: `
+The "trash" subcommand is for managing the files and directories removed by "rm --trash".
+
+Removed items are moved into a trash folder of the user within the collection, i.e. "<collection>/` + trashDirName + `/<username>", together with their metadata.  The trash of the collection containing the current directory is used, unless another collection is specified with the "--collection" flag.
+		`,
+	}
+	cmd.PersistentFlags().StringVarP(&trashCollection, "collection", "C", "", "`path` within the collection of which the trash is used (default the current directory)")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list the items in the trash",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := getTrashRoot()
+			if err != nil {
+				return err
+			}
+			items, err := listTrash(root)
+			if err != nil {
+				return err
+			}
+			for _, t := range items {
+				p := t.Path
+				if t.Dir {
+					p += "/"
+				}
+				fmt.Printf("%s %s %12d %s\n", t.ID, t.Deleted.Local().Format(time.RFC3339), t.Size, p)
+			}
+			return nil
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore <id>...",
+		Short: "restore items from the trash to their original path",
+		Long: `
+The "restore" subcommand moves items from the trash back to the path they were removed from.  An item is not restored if a file or directory with the same path exists; the flag "--to" restores a single item to another path.
+		`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := getTrashRoot()
+			if err != nil {
+				return err
+			}
+			if trashRestoreTo != "" && len(args) > 1 {
+				return fmt.Errorf("flag --to applies to a single item")
+			}
+			dst := ""
+			if trashRestoreTo != "" {
+				dst = getCleanRepoPath(trashRestoreTo)
+			}
+			var errs []error
+			for _, id := range args {
+				t, err := getTrashInfo(root, id)
+				if err == nil {
+					var p string
+					p, err = restoreFromTrash(cmd.Context(), t, root, dst)
+					if err == nil {
+						log.Infof("restored %s", p)
+					}
+				}
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		},
+	}
+	restore.Flags().StringVarP(&trashRestoreTo, "to", "", "", "repository `path` to restore the item to, instead of its original path")
+
+	empty := &cobra.Command{
+		Use:   "empty [<id>...]",
+		Short: "permanently remove items from the trash",
+		Long: `
+The "empty" subcommand permanently removes the given items, or all items, from the trash.  The flag "--older-than" only removes the items that are removed longer ago than the given duration.
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := getTrashRoot()
+			if err != nil {
+				return err
+			}
+			items, err := listTrash(root)
+			if err != nil {
+				return err
+			}
+			ids := make(map[string]bool)
+			for _, id := range args {
+				ids[id] = true
+			}
+			var errs []error
+			n := 0
+			for _, t := range items {
+				if len(ids) > 0 && !ids[t.ID] {
+					continue
+				}
+				delete(ids, t.ID)
+				if trashOlderThan > 0 && time.Since(t.Deleted) < trashOlderThan {
+					continue
+				}
+				err := withRetry(cmd.Context(), "remove "+path.Join(root, t.ID), func() error {
+					return cli.RemoveAll(path.Join(root, t.ID))
+				})
+				if err == nil {
+					n++
+				}
+				errs = append(errs, err)
+			}
+			for id := range ids {
+				errs = append(errs, fmt.Errorf("no item %s in the trash %s", id, root))
+			}
+			log.Infof("removed %d items from the trash", n)
+			return errors.Join(errs...)
+		},
+	}
+	empty.Flags().DurationVarP(&trashOlderThan, "older-than", "", 0, "only remove the items removed longer than `duration` ago")
+
+	cmd.AddCommand(list, restore, empty)
+	return cmd
+}
+
+// addTrashFlag adds the flag for removing into the trash to the command `cmd`.
+func addTrashFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&useTrash, "trash", "", false, "move into the trash of the collection instead of removing permanently")
+}
@@ -0,0 +1,109 @@
+package repocli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTrashRoot(t *testing.T) {
+
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	newDavClient("alice", "")
+	for p, expected := range map[string]string{
+		"/dccn/DAC_3010000.01_173/data/a.txt": "/dccn/DAC_3010000.01_173/.repocli-trash/alice",
+		"/dccn/DAC_3010000.01_173":            "/dccn/DAC_3010000.01_173/.repocli-trash/alice",
+		"/dccn":                               "",
+		"/":                                   "",
+	} {
+		root, err := trashRoot(p)
+		if root != expected || (expected == "") != (err != nil) {
+			t.Errorf("%s: got %q (%v), expected %q", p, root, err, expected)
+		}
+	}
+}
+
+func TestUndoOperation(t *testing.T) {
+
+	var moves []string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "MOVE" || r.Header.Get("Overwrite") != "F" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		dst := r.Header.Get("Destination")
+		moves = append(moves, r.URL.Path+" "+dst[strings.Index(dst, "/dav/"):])
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	recordOperation(journalEntry{Op: "mv", Moves: []journalMove{{From: "/data/a.txt", To: "/data/b.txt"}}})
+	if _, err := undoOperation(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 1 || moves[0] != "/dav/data/b.txt /dav/data/a.txt" {
+		t.Errorf("unexpected moves: %v", moves)
+	}
+
+	// the operation is undone only once
+	if _, err := undoOperation(context.Background()); err == nil {
+		t.Errorf("expected nothing to undo")
+	}
+
+	// a move replacing a backed up destination moves the backup back after the file
+	moves = nil
+	recordOperation(journalEntry{Op: "mv", Moves: []journalMove{{From: "/data/b.txt", To: "/data/b.txt.1"}, {From: "/data/a.txt", To: "/data/b.txt"}}})
+	if _, err := undoOperation(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(moves, ", ") != "/dav/data/b.txt /dav/data/a.txt, /dav/data/b.txt.1 /dav/data/b.txt" {
+		t.Errorf("unexpected moves: %v", moves)
+	}
+
+	recordOperation(journalEntry{Op: "rm", Irreversible: "/data/a.txt is removed permanently"})
+	if _, err := undoOperation(context.Background()); err == nil || !strings.Contains(err.Error(), "removed permanently") {
+		t.Errorf("unexpected error undoing a permanent removal: %v", err)
+	}
+}
+
+func TestMoveJournal(t *testing.T) {
+
+	// the destination /data/b.txt exists, and is kept by renaming the moved file to b.txt.1.
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PROPFIND" && r.URL.Path == "/dav/data/b.txt":
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dav/data/b.txt</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>1</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+</d:multistatus>`)
+		case r.Method == "PROPFIND":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "MOVE":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	defer func(p conflictPolicy) { onConflict = p }(onConflict)
+	src := pathFileInfo{path: "/data/a.txt", info: testFileInfo{name: "a.txt", size: 1}}
+
+	onConflict = conflictRename
+	written, _, skipped, err := cliCopyOrRename(context.Background(), Move, src, "/data/b.txt")
+	if err != nil || skipped || written != "/data/b.txt.1" {
+		t.Errorf("rename: unexpected result %s, %t, %v", written, skipped, err)
+	}
+
+	// the existing destination is renamed to b.txt.1 by the backup policy
+	onConflict = conflictBackup
+	written, backup, _, err := cliCopyOrRename(context.Background(), Move, src, "/data/b.txt")
+	if err != nil || written != "/data/b.txt" || backup != "/data/b.txt.1" {
+		t.Errorf("backup: unexpected result %s, %s, %v", written, backup, err)
+	}
+
+	onConflict = conflictSkip
+	if _, _, skipped, err := cliCopyOrRename(context.Background(), Move, src, "/data/b.txt"); err != nil || !skipped {
+		t.Errorf("skip: unexpected result %t, %v", skipped, err)
+	}
+}
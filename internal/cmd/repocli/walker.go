@@ -0,0 +1,329 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// opQueueSize is the size of the queue between the walker and the operation workers.
+// It bounds the memory usage for walking through a large directory tree, as the
+// walker is blocked when the queue is full.
+const opQueueSize = 1024
+
+// maxListWorkers is the maximum number of concurrent workers listing directories in the walker.
+const maxListWorkers = 8
+
+// getNumListWorkers returns the number of concurrent workers listing directories in the walker,
+// which follows the number of workers given by `--nthreads` up to `maxListWorkers`.  In the
+// `auto` mode, it follows the initial concurrency.
+func getNumListWorkers() int {
+	switch n := nthreads.n; {
+	case n < 1:
+		return 1
+	case n > maxListWorkers:
+		return maxListWorkers
+	default:
+		return n
+	}
+}
+
+// treeWalker walks through a directory tree at the source, and pushes the files found in
+// the tree into an operation queue, together with the corresponding paths at the destination.
+//
+// Directories are listed concurrently by a pool of listing workers, separated from the
+// operation workers.  The listing workers are blocked when the operation queue is full,
+// and only the directories pending to be listed are kept in memory.
+type treeWalker struct {
+	// list lists the content of a directory at the source.
+	list func(dir string) ([]fs.FileInfo, error)
+	// tree lists the whole directory tree at the source, passing on the entries in batches of
+	// entries in the same directory.  It is optional, and the tree is walked with `list` if it
+	// returns `errTreeUnsupported`.
+	tree func(ctx context.Context, root string, fn func(dir string, files []fs.FileInfo)) error
+	// skip leaves out the files and directories for which it returns true.  It is optional.
+	skip func(f fs.FileInfo) bool
+	// joinSrc and joinDst join path elements at the source and at the destination.
+	joinSrc, joinDst func(elem ...string) string
+	// onList is called with the content of every directory, e.g. for updating the progress bar.
+	// It is optional.
+	onList func(dir opInput, files []fs.FileInfo)
+	// onDir is called for every sub-directory before its content is walked, e.g. for creating
+	// the directory at the destination.  The sub-directory is skipped if it returns false.
+	// It is optional.
+	onDir func(dir opInput) bool
+	// onFail is called for every directory of which the content is not completely walked, because
+	// the directory, or the directory tree containing it, cannot be listed.  It is optional.
+	onFail func(dir opInput, err error)
+}
+
+// walk walks through the directory tree of `root.src`, and pushes the files into `ichan`.
+// It blocks until the whole tree is walked or the context `ctx` is done.  The channel `ichan`
+// is not closed by the walker.
+//
+// It returns the errors of listing the directories, in which case the tree is walked partially;
+// the directories not completely walked are passed to `onFail`.
+func (w *treeWalker) walk(ctx context.Context, root opInput, ichan chan<- opInput) error {
+
+	if w.tree != nil {
+		err := w.walkTree(ctx, root, ichan)
+		if !errors.Is(err, errTreeUnsupported) {
+			return err
+		}
+	}
+
+	var mutex sync.Mutex
+	cond := sync.NewCond(&mutex)
+
+	// directories pending to be listed, walked depth-first to keep the list short.
+	pending := []opInput{root}
+	// number of directories being listed
+	active := 0
+	// errors of listing directories
+	var errs []error
+
+	// wake up the idle workers when the context is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mutex.Lock()
+			cond.Broadcast()
+			mutex.Unlock()
+		case <-stop:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < getNumListWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mutex.Lock()
+				for len(pending) == 0 && active > 0 && ctx.Err() == nil {
+					cond.Wait()
+				}
+				if len(pending) == 0 || ctx.Err() != nil {
+					// the whole tree is walked, or the walk is cancelled.
+					cond.Broadcast()
+					mutex.Unlock()
+					return
+				}
+				dir := pending[len(pending)-1]
+				pending = pending[:len(pending)-1]
+				active++
+				mutex.Unlock()
+
+				subdirs, err := w.walkDir(ctx, dir, ichan)
+
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+				pending = append(pending, subdirs...)
+				active--
+				cond.Broadcast()
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// walkDir lists the directory `dir.src` and pushes the files into `ichan`.  It returns the
+// sub-directories to be walked, or the error of listing the directory.
+func (w *treeWalker) walkDir(ctx context.Context, dir opInput, ichan chan<- opInput) ([]opInput, error) {
+
+	files, err := w.list(dir.src.path)
+	if err != nil {
+		err = fmt.Errorf("cannot list directory %s: %w", dir.src.path, err)
+		if w.onFail != nil {
+			w.onFail(dir, err)
+		}
+		return nil, err
+	}
+
+	files = w.filter(files)
+	if w.onList != nil {
+		w.onList(dir, files)
+	}
+
+	subdirs := make([]opInput, 0)
+	for _, finfo := range files {
+		in := w.input(dir, finfo)
+
+		if finfo.IsDir() {
+			if w.onDir == nil || w.onDir(in) {
+				subdirs = append(subdirs, in)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debugf("stopping walk of %s ...\n", dir.src.path)
+			return nil, nil
+		case ichan <- in:
+		}
+	}
+	return subdirs, nil
+}
+
+// walkTree walks through the directory tree of `root.src` listed by `w.tree`, and pushes the files
+// into `ichan`.  If the listing breaks after partial results, the root and all directories seen so
+// far are passed to `onFail`, as the entries of a directory may be spread over the listing.
+func (w *treeWalker) walkTree(ctx context.Context, root opInput, ichan chan<- opInput) error {
+
+	rootPath := path.Clean(root.src.path)
+
+	// directories seen in the listing, excluding the root
+	seen := []opInput{}
+
+	// directories skipped by `onDir`
+	skipped := make(map[string]bool)
+	isSkipped := func(dir string) bool {
+		for ; dir != rootPath && dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if skipped[dir] {
+				return true
+			}
+		}
+		return false
+	}
+
+	err := w.tree(ctx, rootPath, func(p string, files []fs.FileInfo) {
+
+		if ctx.Err() != nil || isSkipped(p) {
+			return
+		}
+
+		dir := opInput{
+			src: pathFileInfo{path: p},
+			dst: pathFileInfo{path: w.joinDst(root.dst.path, strings.TrimPrefix(p, rootPath))},
+		}
+
+		files = w.filter(files)
+		if w.onList != nil {
+			w.onList(dir, files)
+		}
+
+		for _, finfo := range files {
+			in := w.input(dir, finfo)
+
+			if finfo.IsDir() {
+				if w.onDir != nil && !w.onDir(in) {
+					skipped[in.src.path] = true
+				} else {
+					seen = append(seen, in)
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				log.Debugf("stopping walk of %s ...\n", rootPath)
+				return
+			case ichan <- in:
+			}
+		}
+	})
+
+	if err == nil || errors.Is(err, errTreeUnsupported) {
+		return err
+	}
+	err = fmt.Errorf("cannot list directory tree %s: %w", rootPath, err)
+	if w.onFail != nil {
+		w.onFail(root, err)
+		for _, dir := range seen {
+			w.onFail(dir, err)
+		}
+	}
+	return err
+}
+
+// input returns the operation input for the file `finfo` in the directory `dir`.
+func (w *treeWalker) input(dir opInput, finfo fs.FileInfo) opInput {
+	return opInput{
+		src: pathFileInfo{
+			path: w.joinSrc(dir.src.path, finfo.Name()),
+			info: finfo,
+		},
+		dst: pathFileInfo{
+			path: w.joinDst(dir.dst.path, finfo.Name()),
+		},
+	}
+}
+
+// filter leaves out the `files` for which `w.skip` returns true.
+func (w *treeWalker) filter(files []fs.FileInfo) []fs.FileInfo {
+	if w.skip == nil {
+		return files
+	}
+	kept := make([]fs.FileInfo, 0, len(files))
+	for _, f := range files {
+		if !w.skip(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// listLocal lists the content of a local directory.
+func listLocal(dir string) ([]fs.FileInfo, error) {
+	return ioutil.ReadDir(dir)
+}
+
+// listRepo lists the content of a repository directory.
+func listRepo(dir string) ([]fs.FileInfo, error) {
+	return cli.ReadDir(dir)
+}
+
+// isPartialRepoFile checks whether the repository file `f` is an upload in progress.
+func isPartialRepoFile(f fs.FileInfo) bool {
+	return !f.IsDir() && isPartialRepo(f.Name())
+}
+
+// removeRepoDirs removes the repository directories `dirs`, deepest first, leaving out those
+// marked in `keep`.  It is used for removing directories after their content has been removed
+// or moved away.  It returns the error of removing the first directory in `dirs`, which is
+// expected to be the root of the tree; errors on other directories are logged.
+func removeRepoDirs(ctx context.Context, dirs []string, keep map[string]bool) error {
+
+	if len(dirs) == 0 {
+		return nil
+	}
+	root := dirs[0]
+
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+
+	var rerr error
+	for _, d := range dirs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if keep[d] {
+			log.Debugf("keep directory with content left behind: %s", d)
+			continue
+		}
+		if err := removeRepo(ctx, pathFileInfo{path: d}); err != nil {
+			if d == root {
+				rerr = err
+			} else {
+				log.Errorf("cannot remove repo dir %s: %s", d, err)
+			}
+		}
+	}
+	return rerr
+}
@@ -0,0 +1,259 @@
+package repocli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/schollz/progressbar/v3"
+)
+
+func TestTreeWalker(t *testing.T) {
+
+	root := t.TempDir()
+
+	files := []string{
+		"a.txt",
+		"d1/b.txt",
+		"d1/d2/c.txt",
+		"d1/d2/d3/d.txt",
+		"skip/e.txt",
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mutex sync.Mutex
+	dirs := []string{}
+
+	w := treeWalker{
+		list:    listLocal,
+		joinSrc: filepath.Join,
+		joinDst: filepath.Join,
+		onDir: func(dir opInput) bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			dirs = append(dirs, dir.dst.path)
+			return dir.src.info.Name() != "skip"
+		},
+	}
+
+	// an unbuffered channel makes sure the walker is not blocked on a slow consumer.
+	ichan := make(chan opInput)
+	go func() {
+		w.walk(context.Background(), opInput{src: pathFileInfo{path: root}, dst: pathFileInfo{path: "dst"}}, ichan)
+		close(ichan)
+	}()
+
+	got := []string{}
+	for in := range ichan {
+		rel, err := filepath.Rel(root, in.src.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.dst.path != filepath.Join("dst", rel) {
+			t.Errorf("unexpected destination of %s: %s", rel, in.dst.path)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+
+	sort.Strings(got)
+	expected := files[:len(files)-1]
+	if len(got) != len(expected) {
+		t.Fatalf("expected files %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected file %s, got %s", expected[i], got[i])
+		}
+	}
+
+	sort.Strings(dirs)
+	expectedDirs := []string{"dst/d1", "dst/d1/d2", "dst/d1/d2/d3", "dst/skip"}
+	if len(dirs) != len(expectedDirs) {
+		t.Fatalf("expected dirs %v, got %v", expectedDirs, dirs)
+	}
+	for i := range dirs {
+		if dirs[i] != expectedDirs[i] {
+			t.Errorf("expected dir %s, got %s", expectedDirs[i], dirs[i])
+		}
+	}
+}
+
+func TestTreeWalkerCancel(t *testing.T) {
+
+	root := t.TempDir()
+	for _, f := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(root, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := treeWalker{
+		list:    listLocal,
+		joinSrc: filepath.Join,
+		joinDst: filepath.Join,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// nobody reads from the channel; the walk should return once the context is cancelled.
+	ichan := make(chan opInput)
+	done := make(chan struct{})
+	go func() {
+		w.walk(ctx, opInput{src: pathFileInfo{path: root}}, ichan)
+		close(done)
+	}()
+
+	cancel()
+	<-done
+}
+
+func TestTreeWalkerListFailure(t *testing.T) {
+
+	root := t.TempDir()
+	for _, f := range []string{"a.txt", "d1/b.txt", "d2/c.txt"} {
+		p := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, nil, 0644)
+	}
+
+	var mutex sync.Mutex
+	failed := []string{}
+
+	w := treeWalker{
+		list: func(dir string) ([]fs.FileInfo, error) {
+			if filepath.Base(dir) == "d1" {
+				return nil, errors.New("listing failed")
+			}
+			return listLocal(dir)
+		},
+		joinSrc: filepath.Join,
+		joinDst: filepath.Join,
+		onFail: func(dir opInput, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failed = append(failed, dir.src.path)
+		},
+	}
+
+	ichan := make(chan opInput, opQueueSize)
+	err := w.walk(context.Background(), opInput{src: pathFileInfo{path: root}}, ichan)
+	close(ichan)
+
+	if err == nil || !strings.Contains(err.Error(), "listing failed") {
+		t.Errorf("expected the listing error, got %v", err)
+	}
+	if len(failed) != 1 || failed[0] != filepath.Join(root, "d1") {
+		t.Errorf("unexpected directories not walked completely: %v", failed)
+	}
+	if len(ichan) != 2 {
+		t.Errorf("expected the files of the other directories, got %d", len(ichan))
+	}
+}
+
+func TestMoveRepoDirListFailure(t *testing.T) {
+
+	var mutex sync.Mutex
+	var moved, deleted []string
+
+	// the source /data/src has the file a.txt and the sub-directory sub, which cannot be listed.
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.Method == "PROPFIND" && r.URL.Path == "/dav/data/src/":
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dav/data/src/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/data/src/a.txt</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>1</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/data/src/sub/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+</d:multistatus>`)
+		case r.Method == "PROPFIND" && r.URL.Path == "/dav/data/src/sub/":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == "PROPFIND":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "MKCOL":
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "MOVE":
+			moved = append(moved, r.URL.Path)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	src := pathFileInfo{path: "/data/src", info: testFileInfo{name: "src", isDir: true}}
+	_, _, err := copyOrMoveRepoDir(context.Background(), Move, src, pathFileInfo{path: "/data/dst"}, pb.DefaultSilent(1))
+
+	if err == nil {
+		t.Errorf("expected the listing error of /data/src/sub")
+	}
+	if len(moved) != 1 || moved[0] != "/dav/data/src/a.txt" {
+		t.Errorf("unexpected moves: %v", moved)
+	}
+	// neither the directory not listed, nor the source containing it, is removed.
+	if len(deleted) != 0 {
+		t.Errorf("unexpected removals: %v", deleted)
+	}
+}
+
+func TestTreeWalkerTreeFailure(t *testing.T) {
+
+	var failed []string
+	w := treeWalker{
+		// the listing breaks after the entries of the root
+		tree: func(ctx context.Context, root string, fn func(dir string, files []fs.FileInfo)) error {
+			fn(root, []fs.FileInfo{testFileInfo{name: "a.txt"}, testFileInfo{name: "sub", isDir: true}})
+			return errors.New("stream broken")
+		},
+		joinSrc: path.Join,
+		joinDst: path.Join,
+		onFail: func(dir opInput, err error) {
+			failed = append(failed, dir.src.path)
+		},
+	}
+
+	ichan := make(chan opInput, opQueueSize)
+	err := w.walk(context.Background(), opInput{src: pathFileInfo{path: "/data"}}, ichan)
+	close(ichan)
+
+	if err == nil || !strings.Contains(err.Error(), "stream broken") {
+		t.Errorf("expected the listing error, got %v", err)
+	}
+	// the entries of the directories seen so far may be incomplete
+	if strings.Join(failed, ",") != "/data,/data/sub" {
+		t.Errorf("unexpected directories not walked completely: %v", failed)
+	}
+}
+
+func TestNumListWorkers(t *testing.T) {
+
+	defer func(v threadsValue) { nthreads = v }(nthreads)
+	for v, expected := range map[string]int{"1": 1, "6": 6, "64": maxListWorkers, "auto": defaultThreads} {
+		if err := nthreads.Set(v); err != nil {
+			t.Fatal(err)
+		}
+		if n := getNumListWorkers(); n != expected {
+			t.Errorf("--nthreads %s: expected %d listing workers, got %d", v, expected, n)
+		}
+	}
+}